@@ -0,0 +1,184 @@
+package redo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Go retries fn in a new goroutine, as with [FnCtx], and returns a channel that
+// will receive the final result of the run once it ends. The channel is
+// buffered, so the goroutine will never block on sending, even if the result is
+// never received, and it will only ever receive a single value. The run is tied
+// to ctx, so cancelling ctx will end it as usual.
+//
+// If the run is limited by [InPool], Go blocks until the pool has room for it,
+// and if ctx is done first, the channel receives the context's error without fn
+// ever being called.
+func Go(ctx context.Context, fn func(context.Context) error, options ...Option) <-chan error {
+	result := make(chan error, 1)
+	release, err := startBackground(ctx, options)
+	if err != nil {
+		result <- err
+		return result
+	}
+	go func() {
+		defer release()
+		result <- FnCtx(ctx, fn, options...)
+	}()
+	return result
+}
+
+// Pool limits the number of runs in the background at any one time, across
+// every run it is passed to with [InPool], so that a correlated outage cannot
+// pile up unlimited background retries. See [NewPool].
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool returns a [*Pool] that allows up to max runs in the background at
+// once. It will panic if max is less than 1.
+func NewPool(max int) *Pool {
+	if max < 1 {
+		panic("redo: NewPool requires max >= 1")
+	}
+	return &Pool{slots: make(chan struct{}, max)}
+}
+
+// InPool limits the background runs started by [Go] and [FnOutCtxHybrid] with
+// the shared [*Pool] p. When the pool is full, they apply backpressure by
+// blocking the caller until another run in the pool ends, or until ctx is
+// done, rather than starting another goroutine. Retriers that run on the
+// caller's goroutine are not limited by it. Defaults to nil, which does not
+// limit background runs.
+func InPool(p *Pool) Option {
+	return func(o *opts) {
+		o.pool = p
+	}
+}
+
+// startBackground waits for room in the pool set in options, if any, and
+// returns the function to call when the background run ends.
+func startBackground(ctx context.Context, options []Option) (release func(), err error) {
+	o := &opts{}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.pool == nil {
+		return func() {}, nil
+	}
+	select {
+	case o.pool.slots <- struct{}{}:
+		return func() { <-o.pool.slots }, nil
+	case <-ctx.Done():
+		return nil, o.ctxErr(ctx)
+	}
+}
+
+// Result holds the final outcome of a run that returns a value, as delivered by
+// [FnOutCtxHybrid].
+type Result[OUT any] struct {
+	Value OUT
+	Err   error
+}
+
+// FnOutCtxHybrid retries fn as with [FnOutCtx], but only waits for the first
+// try, so that the common case of success on the first try is handled inline
+// while any retries happen in the background. It returns the value and error
+// of the first try, along with a channel that will receive the final [Result]
+// of the run and then be closed.
+//
+// The first try is made on the caller's goroutine, so a panic in it reaches
+// the caller, and ends the run with a halt. Its outcome is reported as the run
+// sees it, after [MapError], [SuccessWhen] and the halting options have been
+// applied: if the run halted or was exhausted on the first try, the error is
+// the one the run ended with, so [Halted] and [Exhausted] tell whether the
+// retries will go on. As with the other retriers, the value is the zero value
+// whenever the error is not nil.
+//
+// If the first try succeeds, the run is already over, and the channel holds the
+// same value. Otherwise, the run carries on in a new goroutine, which delivers
+// the eventual outcome. The channel is buffered, so the goroutine will never
+// block on sending, even if the result is never received. The run is tied to
+// ctx as usual, so cancelling ctx is the way to stop the background retries
+// early, in which case the channel will receive the cancellation error.
+//
+// If the run is limited by [InPool], FnOutCtxHybrid blocks until the pool has
+// room for it before making the first try, as with [Go].
+func FnOutCtxHybrid[OUT any](
+	ctx context.Context,
+	fn func(context.Context) (OUT, error),
+	options ...Option,
+) (OUT, error, <-chan Result[OUT]) {
+	type tryResult struct {
+		val OUT
+		err error
+	}
+	var (
+		zero OUT
+		// the context of the first try, sent to the caller's goroutine to
+		// make it on, which sends back its result.
+		firstCtx = make(chan context.Context)
+		firstRes = make(chan tryResult)
+		// the outcome of the first try, once the run has decided it.
+		outcome = make(chan error, 1)
+		once    sync.Once
+		result  = make(chan Result[OUT], 1)
+	)
+	decided := func(err error) {
+		once.Do(func() { outcome <- err })
+	}
+	release, err := startBackground(ctx, options)
+	if err != nil {
+		result <- Result[OUT]{Err: err}
+		close(result)
+		return zero, err, result
+	}
+	go func() {
+		defer release()
+		first := true
+		val, err := FnOutCtx(ctx, func(ctx context.Context) (OUT, error) {
+			if first {
+				first = false
+				firstCtx <- ctx
+				r := <-firstRes
+				return r.val, r.err
+			}
+			return fn(ctx)
+		}, append(options[:len(options):len(options)], func(o *opts) { o.firstOutcome = decided })...)
+		// the run may end on the first try, or before it, such as with
+		// Validate.
+		close(firstCtx)
+		decided(err)
+		result <- Result[OUT]{Value: val, Err: err}
+		close(result)
+	}()
+	var val OUT
+	if tctx, ok := <-firstCtx; ok {
+		val = runFirst(tctx, fn, func(val OUT, err error) { firstRes <- tryResult{val, err} })
+	}
+	if err := <-outcome; err != nil {
+		return zero, err, result
+	}
+	return val, nil, result
+}
+
+// runFirst calls fn with ctx and passes its result to done, for the first try
+// of FnOutCtxHybrid. If fn panics, done is passed a halting error, so that the
+// run ends, before the panic carries on.
+func runFirst[OUT any](ctx context.Context, fn func(context.Context) (OUT, error), done func(OUT, error)) OUT {
+	var (
+		val OUT
+		err error
+	)
+	defer func() {
+		if r := recover(); r != nil {
+			var zero OUT
+			done(zero, Halt(fmt.Errorf("redo: first try panicked: %v", r)))
+			panic(r)
+		}
+	}()
+	val, err = fn(ctx)
+	done(val, err)
+	return val
+}
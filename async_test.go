@@ -0,0 +1,173 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGo(t *testing.T) {
+	tries := 0
+	done := Go(context.Background(), func(context.Context) error {
+		tries++
+		if tries < 2 {
+			return errors.New("fail")
+		}
+		return nil
+	}, InitialDelay(time.Millisecond))
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want success", err)
+	}
+
+	done = Go(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxTries(2))
+	if err := <-done; !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+
+	// the result can be abandoned without blocking the goroutine
+	Go(context.Background(), func(context.Context) error { return nil })
+}
+
+func TestFnOutCtxHybrid(t *testing.T) {
+	val, err, result := FnOutCtxHybrid(context.Background(), func(context.Context) (string, error) {
+		return "fast", nil
+	})
+	if val != "fast" || err != nil {
+		t.Fatalf("got %q, %v; want first-try success", val, err)
+	}
+	if r := <-result; r.Value != "fast" || r.Err != nil {
+		t.Fatalf("got result %+v, want the first-try value", r)
+	}
+	if _, ok := <-result; ok {
+		t.Fatal("expected the channel to be closed after the result")
+	}
+
+	errFail := errors.New("fail")
+	tries := 0
+	val, err, result = FnOutCtxHybrid(context.Background(), func(context.Context) (string, error) {
+		tries++
+		if tries < 3 {
+			return "", errFail
+		}
+		return "recovered", nil
+	}, InitialDelay(time.Millisecond))
+	if val != "" || err != errFail {
+		t.Fatalf("got %q, %v; want the first try's failure", val, err)
+	}
+	if r := <-result; r.Value != "recovered" || r.Err != nil || tries != 3 {
+		t.Fatalf("got result %+v after %d tries, want recovery on try 3", r, tries)
+	}
+
+	// cancelling ctx stops the background retries.
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err, result = FnOutCtxHybrid(ctx, func(context.Context) (string, error) {
+		return "", errFail
+	}, InitialDelay(time.Hour))
+	cancel()
+	if r := <-result; err != errFail || !errors.Is(r.Err, context.Canceled) {
+		t.Fatalf("got first error %v and result %+v, want cancellation", err, r)
+	}
+
+	// the first outcome is the one the run decided on, with the zero value
+	// alongside an error.
+	val, err, _ = FnOutCtxHybrid(context.Background(), func(context.Context) (string, error) {
+		return "partial", errFail
+	}, SuccessWhen(func(err error) bool { return errors.Is(err, errFail) }))
+	if val != "partial" || err != nil {
+		t.Fatalf("got %q, %v; want success from SuccessWhen", val, err)
+	}
+	val, err, result = FnOutCtxHybrid(context.Background(), func(context.Context) (string, error) {
+		return "partial", errFail
+	}, HaltFn(func(error) bool { return true }))
+	if val != "" || !Halted(err) || !errors.Is(err, errFail) {
+		t.Fatalf("got %q, %v; want the zero value and a halt", val, err)
+	}
+	if r := <-result; !Halted(r.Err) {
+		t.Fatalf("got result %+v, want halted", r)
+	}
+	val, _, _ = FnOutCtxHybrid(context.Background(), func(context.Context) (string, error) {
+		return "partial", errFail
+	}, InitialDelay(time.Hour), MaxTries(2))
+	if val != "" {
+		t.Fatalf("got %q alongside an error, want the zero value", val)
+	}
+}
+
+func TestFnOutCtxHybridPanic(t *testing.T) {
+	var result <-chan Result[int]
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("got panic %v, want boom on the caller's goroutine", r)
+			}
+		}()
+		_, _, result = FnOutCtxHybrid(context.Background(), func(context.Context) (int, error) {
+			panic("boom")
+		})
+	}()
+	if result != nil {
+		t.Fatal("FnOutCtxHybrid returned after its first try panicked")
+	}
+}
+
+func TestInPool(t *testing.T) {
+	const limit = 2
+	pool := NewPool(limit)
+	var (
+		mu      sync.Mutex
+		active  int
+		highest int
+	)
+	fn := func(context.Context) error {
+		mu.Lock()
+		active++
+		highest = max(highest, active)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	}
+	var results []<-chan error
+	for range 3 {
+		results = append(results, Go(context.Background(), fn, InPool(pool)))
+		_, _, r := FnOutCtxHybrid(context.Background(), func(ctx context.Context) (int, error) {
+			return 0, fn(ctx)
+		}, InPool(pool))
+		results = append(results, Go(context.Background(), func(context.Context) error {
+			return (<-r).Err
+		}))
+	}
+	for _, r := range results {
+		if err := <-r; err != nil {
+			t.Fatalf("got %v, want success", err)
+		}
+	}
+	if highest > limit {
+		t.Fatalf("got %d concurrent runs, want at most %d", highest, limit)
+	}
+
+	// when the pool is full, a done context ends the run before it starts.
+	block := make(chan struct{})
+	defer close(block)
+	pool = NewPool(1)
+	Go(context.Background(), func(context.Context) error {
+		<-block
+		return nil
+	}, InPool(pool))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	called := false
+	err := <-Go(ctx, func(context.Context) error {
+		called = true
+		return nil
+	}, InPool(pool))
+	if called || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v (called: %v), want the deadline before the run started", err, called)
+	}
+}
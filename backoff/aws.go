@@ -0,0 +1,60 @@
+package backoff
+
+import (
+	"math"
+	"time"
+)
+
+// AWS returns an Iterator using the "decorrelated jitter" algorithm described
+// in the AWS Architecture Blog post "Exponential Backoff And Jitter", where
+// each delay is chosen at random between initial and three times the previous
+// delay, and capped at maxDelay:
+//
+//	delay = min(maxDelay, random_between(initial, previous*3))
+//
+// Unlike the soft exponential curve used by [New], there is no fixed schedule:
+// delays grow by about 1.5x per step on average, but any delay may fall back
+// as low as initial, and they are spread much more widely, from initial to
+// three times the previous delay. Since each delay depends on the last, the
+// retries of clients that failed at the same moment drift apart quickly, at
+// the cost of being less predictable for any one client.
+//
+// Every delay is within [initial, maxDelay], unless maxDelay is less than
+// initial, in which case every delay is maxDelay. If maxDelay is 0, delays are
+// not capped. If initial is 0, every delay is 0. [Median] makes each delay the
+// midpoint of its range. It will panic if either argument is negative.
+func AWS(initial, maxDelay time.Duration, options ...Option) Iterator {
+	if maxDelay < 0 {
+		panic("maxDelay must not be negative")
+	}
+	if initial < 0 {
+		panic("initial must not be negative")
+	}
+	cfg := &config{}
+	for _, o := range options {
+		o(cfg)
+	}
+	base := float64(initial)
+	maxDf := maxintf
+	if maxDelay > 0 {
+		maxDf = float64(maxDelay)
+	}
+	prev := base
+	return func() time.Duration {
+		if initial == 0 {
+			return 0
+		}
+		hi := prev * 3
+		next := base + cfg.float64()*(hi-base)
+		switch {
+		case math.IsNaN(next) || next >= maxDf:
+			prev = maxDf
+		default:
+			prev = next
+		}
+		if prev >= maxintf {
+			return time.Duration(math.MaxInt64)
+		}
+		return time.Duration(prev)
+	}
+}
@@ -0,0 +1,69 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestAWS(t *testing.T) {
+	const (
+		initial  = 10 * time.Millisecond
+		maxDelay = time.Second
+	)
+	rnd := rand.New(rand.NewSource(1))
+	for range 100 {
+		next := AWS(initial, maxDelay, WithRand(rnd))
+		prev := initial
+		for i := range 50 {
+			d := next()
+			if d < initial || d > maxDelay {
+				t.Fatalf("step %d: delay %v outside of [%v, %v]", i, d, initial, maxDelay)
+			}
+			// each delay is bounded by the one before it.
+			if d > 3*prev {
+				t.Fatalf("step %d: delay %v more than 3x previous delay %v", i, d, prev)
+			}
+			prev = d
+		}
+	}
+}
+
+func TestAWSMedian(t *testing.T) {
+	next := AWS(time.Second, 0, Median())
+	// the midpoint of [1s, 3s], then of [1s, 6s].
+	for _, want := range []time.Duration{2 * time.Second, 3500 * time.Millisecond} {
+		if d := next(); d != want {
+			t.Fatalf("got %v, want %v", d, want)
+		}
+	}
+}
+
+func TestAWSPathologicalValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  time.Duration
+		maxDelay time.Duration
+		want     time.Duration // every delay, if non-zero
+	}{
+		{"zero initial", 0, time.Second, 0},
+		{"cap below initial", time.Second, time.Millisecond, time.Millisecond},
+		{"uncapped", time.Hour, 0, -1},
+		{"max initial", math.MaxInt64, 0, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := AWS(tt.initial, tt.maxDelay)
+			for i := range 2000 {
+				d := next()
+				if d < 0 {
+					t.Fatalf("iteration %d: negative delay %d", i, d)
+				}
+				if tt.want >= 0 && d != tt.want {
+					t.Fatalf("iteration %d: got %v, want %v", i, d, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -13,10 +13,73 @@ const (
 
 type Iterator func() time.Duration
 
-func New(initialMedian time.Duration, maxDelay time.Duration, firstFast bool) Iterator {
+// Option configures optional behavior of an [Iterator].
+type Option func(c *config)
+
+// WithRand sets the random number generator used to jitter delays. If r is
+// nil, the global math/rand functions are used. A *rand.Rand is not safe for
+// concurrent use, so it should not be shared between iterators that are used
+// concurrently.
+func WithRand(r *rand.Rand) Option {
+	return func(c *config) {
+		c.rnd = r
+	}
+}
+
+// Median disables jitter, so that each delay is the median delay for its step
+// in the curve. This is mainly useful to estimate how long a schedule will take.
+func Median() Option {
+	return func(c *config) {
+		c.median = true
+	}
+}
+
+// Symmetric changes how delays are jittered, so that they are spread evenly
+// around the median delay for each step rather than skewed by it.
+//
+// By default, jitter moves the point sampled on the curve anywhere within the
+// step, and each delay is the distance from the previous point. Since both
+// points are random, delays range from close to zero up to about twice the
+// median, and the curve is steep enough that their average runs slightly later
+// than the median. With Symmetric, the points stay at the median of each step
+// and the delay between them is scaled by a random factor in [0.5, 1.5), so
+// delays are uniformly distributed within 50% either side of the median, and
+// their mean and median both match it. This gives more predictable delays at
+// the cost of spreading out retries from many clients less.
+func Symmetric() Option {
+	return func(c *config) {
+		c.symmetric = true
+	}
+}
+
+type config struct {
+	rnd       *rand.Rand
+	median    bool
+	symmetric bool
+}
+
+func (c *config) float64() float64 {
+	switch {
+	case c.median:
+		return 0.5
+	case c.rnd == nil:
+		return rand.Float64()
+	default:
+		return c.rnd.Float64()
+	}
+}
+
+func New(initialMedian time.Duration, maxDelay time.Duration, firstFast bool, options ...Option) Iterator {
 	if maxDelay < 0 {
 		panic("maxDelay must not be negative")
 	}
+	if initialMedian < 0 {
+		panic("initialMedian must not be negative")
+	}
+	cfg := &config{}
+	for _, o := range options {
+		o(cfg)
+	}
 	initial := float64(initialMedian)
 	maxDf := float64(maxDelay)
 	var (
@@ -24,18 +87,33 @@ func New(initialMedian time.Duration, maxDelay time.Duration, firstFast bool) It
 		i    int
 	)
 	return func() time.Duration {
-		if i == 0 && firstFast {
+		if (i == 0 && firstFast) || initialMedian == 0 {
 			i++
 			return 0
 		}
-		t := float64(i) + rand.Float64()
+		var t float64
+		if cfg.symmetric {
+			t = float64(i) + 0.5
+		} else {
+			t = float64(i) + cfg.float64()
+		}
 		i++
 		next := math.Pow(2, t) * math.Tanh(math.Sqrt(smoothing*t))
 		out := (next - prev) * initial
+		if cfg.symmetric {
+			out *= 0.5 + cfg.float64()
+		}
 		switch {
+		case math.IsNaN(out):
+			// NaN should be unreachable with a non-zero median, but if the
+			// curve ever becomes nonsensical, treat it as overflow.
+			if maxDelay > 0 {
+				return maxDelay
+			}
+			return time.Duration(math.MaxInt64)
 		case maxDelay > 0 && out > maxDf:
 			return maxDelay
-		case out > maxintf:
+		case out >= maxintf:
 			// maxintf serves as a backstop against float64->int64 overflow
 			return time.Duration(math.MaxInt64)
 		default:
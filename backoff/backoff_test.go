@@ -0,0 +1,123 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPathologicalValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  time.Duration
+		maxDelay time.Duration
+	}{
+		{"zero initial", 0, 0},
+		{"zero initial capped", 0, time.Second},
+		{"one nanosecond", 1, 0},
+		{"max initial", math.MaxInt64, 0},
+		{"max initial capped", math.MaxInt64, time.Hour},
+		{"max both", math.MaxInt64, math.MaxInt64},
+		{"tiny cap", time.Hour, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := New(tt.initial, tt.maxDelay, false)
+			for i := range 2000 {
+				d := next()
+				if d < 0 {
+					t.Fatalf("iteration %d: negative delay %d", i, d)
+				}
+				if tt.maxDelay > 0 && d > tt.maxDelay {
+					t.Fatalf("iteration %d: delay %v exceeds max %v", i, d, tt.maxDelay)
+				}
+				if tt.initial == 0 && d != 0 {
+					t.Fatalf("iteration %d: got delay %v for zero initial median", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestNegativeInitialPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for negative initial median")
+		}
+	}()
+	New(-1, 0, false)
+}
+
+func TestJitterDistribution(t *testing.T) {
+	const (
+		runs    = 5000
+		initial = time.Second
+	)
+	for _, step := range []int{0, 2, 4} {
+		median := New(initial, 0, false, Median())
+		var target time.Duration
+		for range step + 1 {
+			target = median()
+		}
+		for _, symmetric := range []bool{false, true} {
+			options := []Option{WithRand(rand.New(rand.NewSource(1)))}
+			if symmetric {
+				options = append(options, Symmetric())
+			}
+			delays := make([]time.Duration, runs)
+			var sum time.Duration
+			for n := range delays {
+				next := New(initial, 0, false, options...)
+				for range step + 1 {
+					delays[n] = next()
+				}
+				sum += delays[n]
+			}
+			slices.Sort(delays)
+			got := delays[runs/2]
+			if diff := math.Abs(float64(got-target)) / float64(target); diff > 0.05 {
+				t.Errorf("step %d, symmetric=%v: median delay %v is more than 5%% from target %v", step, symmetric, got, target)
+			}
+			if !symmetric {
+				continue
+			}
+			if mean := sum / runs; math.Abs(float64(mean-target))/float64(target) > 0.02 {
+				t.Errorf("step %d: mean delay %v is more than 2%% from target %v", step, mean, target)
+			}
+			if lo, hi := delays[0], delays[runs-1]; lo < target/2 || hi > target*3/2 {
+				t.Errorf("step %d: delays range over [%v, %v], want within 50%% of %v", step, lo, hi, target)
+			}
+		}
+	}
+}
+
+func FuzzBackoff(f *testing.F) {
+	f.Add(int64(time.Second), int64(20*time.Minute), false, uint16(100), int64(1))
+	f.Add(int64(0), int64(0), true, uint16(10), int64(1))
+	f.Add(int64(1), int64(0), false, uint16(2000), int64(2))
+	f.Add(int64(math.MaxInt64), int64(math.MaxInt64), false, uint16(50), int64(3))
+	f.Add(int64(time.Hour), int64(1), true, uint16(50), int64(4))
+	f.Fuzz(func(t *testing.T, initial, maxDelay int64, firstFast bool, iterations uint16, seed int64) {
+		if initial < 0 || maxDelay < 0 {
+			t.Skip("negative arguments panic by design")
+		}
+		rnd := rand.New(rand.NewSource(seed))
+		for _, options := range [][]Option{{WithRand(rnd)}, {Median()}, {WithRand(rnd), Symmetric()}} {
+			next := New(time.Duration(initial), time.Duration(maxDelay), firstFast, options...)
+			for i := range int(iterations) {
+				d := next()
+				if d < 0 {
+					t.Fatalf("iteration %d: negative delay %d", i, d)
+				}
+				if maxDelay > 0 && d > time.Duration(maxDelay) {
+					t.Fatalf("iteration %d: delay %v exceeds max %v", i, d, time.Duration(maxDelay))
+				}
+				if (initial == 0 || (i == 0 && firstFast)) && d != 0 {
+					t.Fatalf("iteration %d: got delay %v, want 0", i, d)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// FromReader returns an Iterator that replays the delays read from r, which
+// must contain one duration per line in the format accepted by
+// [time.ParseDuration], such as "1.5s". Blank lines are ignored. Once every
+// delay has been returned, the last one will be repeated indefinitely.
+//
+// All of r is read and validated up front, so an error is returned if any
+// line cannot be parsed, if any delay is negative, or if there are no delays.
+func FromReader(r io.Reader) (Iterator, error) {
+	var delays []time.Duration
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("line %d: negative delay %v", line, d)
+		}
+		delays = append(delays, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(delays) == 0 {
+		return nil, errors.New("no delays")
+	}
+	var i int
+	return func() time.Duration {
+		d := delays[i]
+		if i < len(delays)-1 {
+			i++
+		}
+		return d
+	}, nil
+}
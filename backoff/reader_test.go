@@ -0,0 +1,22 @@
+package backoff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromReaderInvalid(t *testing.T) {
+	tests := []struct {
+		name, input, err string
+	}{
+		{"malformed", "1s\nsoon\n", "line 2"},
+		{"negative", "-1s", "negative"},
+		{"empty", "\n\n", "no delays"},
+	}
+	for _, tt := range tests {
+		_, err := FromReader(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+		}
+	}
+}
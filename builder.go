@@ -0,0 +1,367 @@
+package redo
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"andy.dev/redo/backoff"
+)
+
+// Builder is an alternative to passing options to a retrier, which allows a
+// configuration to be built by chaining methods:
+//
+//	err := redo.NewBuilder().MaxTries(3).InitialDelay(time.Second).Do(ctx, fn)
+//
+// Each method adds the option of the same name, so they behave exactly as the
+// options do, including later options overriding earlier ones. Since methods
+// cannot have type parameters, [Builder.Do] only retries functions of the same
+// signature as [FnCtx]; for the other retriers, pass [Builder.Options]:
+//
+//	out, err := redo.FnOutCtx(ctx, fn, b.Options()...)
+//
+// A Builder is not safe for concurrent use while it is being built.
+type Builder struct {
+	options []Option
+}
+
+// NewBuilder returns an empty [*Builder].
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Options returns the options added to the builder so far.
+func (b *Builder) Options() []Option {
+	return append([]Option(nil), b.options...)
+}
+
+// With adds arbitrary options to the builder.
+func (b *Builder) With(options ...Option) *Builder {
+	b.options = append(b.options, options...)
+	return b
+}
+
+// Do retries fn with the options added to the builder, as with [FnCtx].
+func (b *Builder) Do(ctx context.Context, fn func(context.Context) error) error {
+	return FnCtx(ctx, fn, b.options...)
+}
+
+// WithPolicy adds the [WithPolicy] option.
+func (b *Builder) WithPolicy(p Policy) *Builder {
+	return b.With(WithPolicy(p))
+}
+
+// InitialDelay adds the [InitialDelay] option.
+func (b *Builder) InitialDelay(duration time.Duration) *Builder {
+	return b.With(InitialDelay(duration))
+}
+
+// InitialDelayJitter adds the [InitialDelayJitter] option.
+func (b *Builder) InitialDelayJitter(spread time.Duration) *Builder {
+	return b.With(InitialDelayJitter(spread))
+}
+
+// MaxDelay adds the [MaxDelay] option.
+func (b *Builder) MaxDelay(duration time.Duration) *Builder {
+	return b.With(MaxDelay(duration))
+}
+
+// MaxDelayRange adds the [MaxDelayRange] option.
+func (b *Builder) MaxDelayRange(min, max time.Duration) *Builder {
+	return b.With(MaxDelayRange(min, max))
+}
+
+// MaxDelayFactor adds the [MaxDelayFactor] option.
+func (b *Builder) MaxDelayFactor(n float64) *Builder {
+	return b.With(MaxDelayFactor(n))
+}
+
+// QuantizeDelay adds the [QuantizeDelay] option.
+func (b *Builder) QuantizeDelay(quantum time.Duration) *Builder {
+	return b.With(QuantizeDelay(quantum))
+}
+
+// MaxTries adds the [MaxTries] option.
+func (b *Builder) MaxTries(tries int) *Builder {
+	return b.With(MaxTries(tries))
+}
+
+// StartAttempt adds the [StartAttempt] option.
+func (b *Builder) StartAttempt(n int) *Builder {
+	return b.With(StartAttempt(n))
+}
+
+// PolicyByError adds the [PolicyByError] option.
+func (b *Builder) PolicyByError(selector func(error) Policy) *Builder {
+	return b.With(PolicyByError(selector))
+}
+
+// ResumeFrom adds the [ResumeFrom] option.
+func (b *Builder) ResumeFrom(s State) *Builder {
+	return b.With(ResumeFrom(s))
+}
+
+// MaxElapsed adds the [MaxElapsed] option.
+func (b *Builder) MaxElapsed(budget time.Duration) *Builder {
+	return b.With(MaxElapsed(budget))
+}
+
+// MaxElapsedJitter adds the [MaxElapsedJitter] option.
+func (b *Builder) MaxElapsedJitter(spread time.Duration) *Builder {
+	return b.With(MaxElapsedJitter(spread))
+}
+
+// AutoTriesFromDeadline adds the [AutoTriesFromDeadline] option.
+func (b *Builder) AutoTriesFromDeadline(enabled bool) *Builder {
+	return b.With(AutoTriesFromDeadline(enabled))
+}
+
+// BudgetFromFirstLatency adds the [BudgetFromFirstLatency] option.
+func (b *Builder) BudgetFromFirstLatency(target time.Duration) *Builder {
+	return b.With(BudgetFromFirstLatency(target))
+}
+
+// RequireBoundedRun adds the [RequireBoundedRun] option.
+func (b *Builder) RequireBoundedRun(enabled bool) *Builder {
+	return b.With(RequireBoundedRun(enabled))
+}
+
+// ContextValueFunc adds the [ContextValueFunc] option.
+func (b *Builder) ContextValueFunc(key any, gen func(try int) any) *Builder {
+	return b.With(ContextValueFunc(key, gen))
+}
+
+// DisableStatusContext adds the [DisableStatusContext] option.
+func (b *Builder) DisableStatusContext() *Builder {
+	return b.With(DisableStatusContext())
+}
+
+// NoDelay adds the [NoDelay] option.
+func (b *Builder) NoDelay() *Builder {
+	return b.With(NoDelay())
+}
+
+// TaperToEnd adds the [TaperToEnd] option.
+func (b *Builder) TaperToEnd(enabled bool) *Builder {
+	return b.With(TaperToEnd(enabled))
+}
+
+// InstantFirstRetry adds the [InstantFirstRetry] option.
+func (b *Builder) InstantFirstRetry(enabled bool) *Builder {
+	return b.With(InstantFirstRetry(enabled))
+}
+
+// Burst adds the [Burst] option.
+func (b *Builder) Burst(n int) *Builder {
+	return b.With(Burst(n))
+}
+
+// Backoff adds the [Backoff] option.
+func (b *Builder) Backoff(newIterator func() backoff.Iterator) *Builder {
+	return b.With(Backoff(newIterator))
+}
+
+// AWSBackoff adds the [AWSBackoff] option.
+func (b *Builder) AWSBackoff() *Builder {
+	return b.With(AWSBackoff())
+}
+
+// FirstFast adds the [FirstFast] option.
+func (b *Builder) FirstFast(firstRetryImmediate bool) *Builder {
+	return b.With(FirstFast(firstRetryImmediate))
+}
+
+// ResetBackoffOnErrorChange adds the [ResetBackoffOnErrorChange] option.
+func (b *Builder) ResetBackoffOnErrorChange(equal func(a, b error) bool) *Builder {
+	return b.With(ResetBackoffOnErrorChange(equal))
+}
+
+// MaxDistinctErrors adds the [MaxDistinctErrors] option.
+func (b *Builder) MaxDistinctErrors(n int, key func(error) string) *Builder {
+	return b.With(MaxDistinctErrors(n, key))
+}
+
+// ExhaustedFormat adds the [ExhaustedFormat] option.
+func (b *Builder) ExhaustedFormat(formatFn func(err error, s Status) string) *Builder {
+	return b.With(ExhaustedFormat(formatFn))
+}
+
+// Validate adds the [Validate] option.
+func (b *Builder) Validate(validateFn func() error) *Builder {
+	return b.With(Validate(validateFn))
+}
+
+// MapError adds the [MapError] option.
+func (b *Builder) MapError(mapFn func(error) error) *Builder {
+	return b.With(MapError(mapFn))
+}
+
+// SuccessWhen adds the [SuccessWhen] option.
+func (b *Builder) SuccessWhen(successFn func(error) bool) *Builder {
+	return b.With(SuccessWhen(successFn))
+}
+
+// HaltFn adds the [HaltFn] option.
+func (b *Builder) HaltFn(haltFn func(error) bool) *Builder {
+	return b.With(HaltFn(haltFn))
+}
+
+// HaltFnStatus adds the [HaltFnStatus] option.
+func (b *Builder) HaltFnStatus(haltFn func(error, Status) bool) *Builder {
+	return b.With(HaltFnStatus(haltFn))
+}
+
+// HaltErrors adds the [HaltErrors] option.
+func (b *Builder) HaltErrors(errs ...error) *Builder {
+	return b.With(HaltErrors(errs...))
+}
+
+// Each adds the [Each] option.
+func (b *Builder) Each(eachFn func(Status)) *Builder {
+	return b.With(Each(eachFn))
+}
+
+// CoalesceEach adds the [CoalesceEach] option.
+func (b *Builder) CoalesceEach(enabled bool) *Builder {
+	return b.With(CoalesceEach(enabled))
+}
+
+// EachExcludesTerminal adds the [EachExcludesTerminal] option.
+func (b *Builder) EachExcludesTerminal(enabled bool) *Builder {
+	return b.With(EachExcludesTerminal(enabled))
+}
+
+// Explain adds the [Explain] option.
+func (b *Builder) Explain(buf *[]string) *Builder {
+	return b.With(Explain(buf))
+}
+
+// Trace adds the [Trace] option.
+func (b *Builder) Trace(w io.Writer) *Builder {
+	return b.With(Trace(w))
+}
+
+// LogNextTime adds the [LogNextTime] option.
+func (b *Builder) LogNextTime(layout string) *Builder {
+	return b.With(LogNextTime(layout))
+}
+
+// Summarize adds the [Summarize] option.
+func (b *Builder) Summarize(logger *slog.Logger, level slog.Level) *Builder {
+	return b.With(Summarize(logger, level))
+}
+
+// SlowAttemptThreshold adds the [SlowAttemptThreshold] option.
+func (b *Builder) SlowAttemptThreshold(d time.Duration, slowFn func(Status, time.Duration)) *Builder {
+	return b.With(SlowAttemptThreshold(d, slowFn))
+}
+
+// WithContextLogger adds the [WithContextLogger] option.
+func (b *Builder) WithContextLogger(
+	extract func(context.Context) *slog.Logger,
+	store func(context.Context, *slog.Logger) context.Context,
+) *Builder {
+	return b.With(WithContextLogger(extract, store))
+}
+
+// OnSleep adds the [OnSleep] option.
+func (b *Builder) OnSleep(sleepFn func(planned, actual time.Duration)) *Builder {
+	return b.With(OnSleep(sleepFn))
+}
+
+// EachOrHalt adds the [EachOrHalt] option.
+func (b *Builder) EachOrHalt(eachFn func(Status) error) *Builder {
+	return b.With(EachOrHalt(eachFn))
+}
+
+// EachCtx adds the [EachCtx] option.
+func (b *Builder) EachCtx(eachFn func(context.Context, Status)) *Builder {
+	return b.With(EachCtx(eachFn))
+}
+
+// CancelOnTerminal adds the [CancelOnTerminal] option.
+func (b *Builder) CancelOnTerminal(enabled bool) *Builder {
+	return b.With(CancelOnTerminal(enabled))
+}
+
+// CtxCause adds the [CtxCause] option.
+func (b *Builder) CtxCause(enabled bool) *Builder {
+	return b.With(CtxCause(enabled))
+}
+
+// Window adds the [Window] option.
+func (b *Builder) Window(allowed func(t time.Time) bool) *Builder {
+	return b.With(Window(allowed))
+}
+
+// Attempts adds the [Attempts] option.
+func (b *Builder) Attempts(n *int) *Builder {
+	return b.With(Attempts(n))
+}
+
+// FinalAttempt adds the [FinalAttempt] option.
+func (b *Builder) FinalAttempt(fn func(context.Context) error) *Builder {
+	return b.With(FinalAttempt(fn))
+}
+
+// ForDependency adds the [ForDependency] option.
+func (b *Builder) ForDependency(name string, l *DependencyLimiter) *Builder {
+	return b.With(ForDependency(name, l))
+}
+
+// OnShutdown adds the [OnShutdown] option.
+func (b *Builder) OnShutdown(shutdown <-chan struct{}) *Builder {
+	return b.With(OnShutdown(shutdown))
+}
+
+// LoadShed adds the [LoadShed] option.
+func (b *Builder) LoadShed(shed func() bool) *Builder {
+	return b.With(LoadShed(shed))
+}
+
+// SkipIfOffline adds the [SkipIfOffline] option.
+func (b *Builder) SkipIfOffline(isOnline func() bool, timeout time.Duration) *Builder {
+	return b.With(SkipIfOffline(isOnline, timeout))
+}
+
+// AllowSubMillisecondDelays adds the [AllowSubMillisecondDelays] option.
+func (b *Builder) AllowSubMillisecondDelays(allowed bool) *Builder {
+	return b.With(AllowSubMillisecondDelays(allowed))
+}
+
+// Rand adds the [Rand] option.
+func (b *Builder) Rand(r *rand.Rand) *Builder {
+	return b.With(Rand(r))
+}
+
+// RunIDFunc adds the [RunIDFunc] option.
+func (b *Builder) RunIDFunc(newID func() string) *Builder {
+	return b.With(RunIDFunc(newID))
+}
+
+// TrackProgress adds the [TrackProgress] option.
+func (b *Builder) TrackProgress(p *Progress) *Builder {
+	return b.With(TrackProgress(p))
+}
+
+// SharedBackoff adds the [SharedBackoff] option.
+func (b *Builder) SharedBackoff(it *SharedIterator) *Builder {
+	return b.With(SharedBackoff(it))
+}
+
+// PublishExpvar adds the [PublishExpvar] option.
+func (b *Builder) PublishExpvar(name string) *Builder {
+	return b.With(PublishExpvar(name))
+}
+
+// InPool adds the [InPool] option.
+func (b *Builder) InPool(p *Pool) *Builder {
+	return b.With(InPool(p))
+}
+
+// WithRetrier adds the [WithRetrier] option.
+func (b *Builder) WithRetrier(r *Retrier) *Builder {
+	return b.With(WithRetrier(r))
+}
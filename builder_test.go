@@ -0,0 +1,50 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder().
+		InitialDelay(time.Millisecond).
+		MaxDelay(5 * time.Millisecond).
+		MaxTries(3).
+		FirstFast(true).
+		CtxCause(false)
+	built := &opts{}
+	for _, o := range b.Options() {
+		o(built)
+	}
+	want := &opts{}
+	for _, o := range []Option{
+		InitialDelay(time.Millisecond),
+		MaxDelay(5 * time.Millisecond),
+		MaxTries(3),
+		FirstFast(true),
+		CtxCause(false),
+	} {
+		o(want)
+	}
+	scalars := func(o *opts) [5]any {
+		return [5]any{o.initialDelay, o.maxDelay, o.maxTries, o.firstFast, o.noCause}
+	}
+	if scalars(built) != scalars(want) {
+		t.Fatalf("builder produced %v, want %v", scalars(built), scalars(want))
+	}
+
+	tries := 0
+	errFatal := errors.New("fatal")
+	err := b.HaltErrors(errFatal).Do(context.Background(), func(context.Context) error {
+		tries++
+		if tries == 2 {
+			return errFatal
+		}
+		return errors.New("fail")
+	})
+	if !Halted(err) || tries != 2 {
+		t.Fatalf("got %v after %d tries, want a halt after 2", err, tries)
+	}
+}
@@ -0,0 +1,49 @@
+package redo
+
+import "time"
+
+// clock abstracts the passage of time so that time-dependent behavior can be
+// tested without waiting on the wall clock.
+//
+// Every duration the retry loop acts on, such as the time elapsed against
+// MaxElapsed or the length of a try, is found by subtracting two readings of
+// Now, never by comparing against a fixed time. With realClock, those readings
+// carry the monotonic clock, which time.Time.Sub prefers, so the loop's
+// decisions are immune to the wall clock being stepped. Readings must not be
+// passed through Round(0), UTC, In or the like before being subtracted, since
+// those strip the monotonic reading. The wall clock is only used where a time
+// of day is wanted: for Window, and to display the time of the next try.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) timer
+}
+
+// timer is the subset of the [*time.Timer] API used by the retry loop.
+type timer interface {
+	Chan() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) Chan() <-chan time.Time {
+	return t.C
+}
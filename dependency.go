@@ -0,0 +1,117 @@
+package redo
+
+import (
+	"context"
+	"sync"
+)
+
+// DependencyLimiter limits how many runs can be retrying each dependency at
+// once, so that during an outage of one service, its callers do not all retry
+// it together. Runs are tied to a dependency by name with [ForDependency], and
+// each name has its own limit, unlike a [*Pool], which limits every run it is
+// given together. See [NewDependencyLimiter].
+//
+// Only runs that are retrying are limited. A run takes a place once its first
+// try fails, and holds it through each delay and try until the run ends, while
+// runs whose first try succeeds never take one.
+type DependencyLimiter struct {
+	max  int
+	shed bool
+
+	mu   sync.Mutex
+	deps map[string]*dependency
+}
+
+// NewDependencyLimiter returns a [*DependencyLimiter] that allows up to max runs
+// to be retrying each dependency at once. When a dependency is at its limit, a
+// run whose first try has failed either queues, waiting for another run
+// retrying it to end, or, if shed is true, halts with [ErrDependencyBusy]
+// without retrying. Queued runs still end if their context is done or the
+// channel set with [OnShutdown] is closed. It will panic if max is less than 1.
+func NewDependencyLimiter(max int, shed bool) *DependencyLimiter {
+	if max < 1 {
+		panic("redo: NewDependencyLimiter requires max >= 1")
+	}
+	return &DependencyLimiter{max: max, shed: shed}
+}
+
+// Retrying returns the number of runs currently retrying the named dependency.
+func (l *DependencyLimiter) Retrying(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d, ok := l.deps[name]; ok {
+		return len(d.slots)
+	}
+	return 0
+}
+
+// ForDependency limits the run with l as a run against the named dependency.
+// Defaults to nil, which does not limit the run.
+func ForDependency(name string, l *DependencyLimiter) Option {
+	return func(o *opts) {
+		o.depName = name
+		o.depLimiter = l
+	}
+}
+
+// dependency holds a value in slots for each run retrying it, and counts the
+// runs holding or waiting for a place, so that it can be dropped once idle.
+type dependency struct {
+	slots chan struct{}
+	users int
+}
+
+// join returns the named dependency, creating it if needed, and counts the run
+// as one of its users until it calls leave.
+func (l *DependencyLimiter) join(name string) *dependency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d, ok := l.deps[name]
+	if !ok {
+		if l.deps == nil {
+			l.deps = make(map[string]*dependency)
+		}
+		d = &dependency{slots: make(chan struct{}, l.max)}
+		l.deps[name] = d
+	}
+	d.users++
+	return d
+}
+
+// leave undoes join, dropping the dependency once it has no users.
+func (l *DependencyLimiter) leave(name string, d *dependency) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d.users--; d.users == 0 {
+		delete(l.deps, name)
+	}
+}
+
+// acquire takes a place for a run retrying the named dependency, queuing or
+// shedding as configured, and returns the function to release it, or false if
+// the run must end without retrying. If the run was queued and no place was
+// taken, either its context is done or shutdown is closed.
+func (l *DependencyLimiter) acquire(ctx context.Context, name string, shutdown <-chan struct{}) (release func(), ok bool) {
+	d := l.join(name)
+	release = func() {
+		<-d.slots
+		l.leave(name, d)
+	}
+	if l.shed {
+		select {
+		case d.slots <- struct{}{}:
+			return release, true
+		default:
+			l.leave(name, d)
+			return nil, false
+		}
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return release, true
+	case <-ctx.Done():
+	case <-shutdown:
+	}
+	l.leave(name, d)
+	return nil, false
+}
@@ -0,0 +1,136 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDependencyLimiterShed(t *testing.T) {
+	errDown := errors.New("down")
+	l := NewDependencyLimiter(1, true)
+	retrying := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = FnCtx(context.Background(), func(ctx context.Context) error {
+			if GetStatus(ctx).TryNumber == 2 {
+				close(retrying)
+				<-done
+			}
+			return errDown
+		}, NoDelay(), MaxTries(2), ForDependency("a", l))
+	}()
+	<-retrying
+	if n := l.Retrying("a"); n != 1 {
+		t.Fatalf("got %d runs retrying a, want 1", n)
+	}
+
+	// a is at its limit, so a second run is shed after its first try.
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errDown
+	}, NoDelay(), ForDependency("a", l))
+	if !Halted(err) || !errors.Is(err, ErrDependencyBusy) || !errors.Is(err, errDown) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want halted ErrDependencyBusy after 1", err, tries)
+	}
+
+	// other dependencies have their own limit.
+	tries = 0
+	err = FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errDown
+	}, NoDelay(), MaxTries(3), ForDependency("b", l))
+	if !Exhausted(err) || tries != 3 {
+		t.Fatalf("got %v after %d tries, want exhausted after 3", err, tries)
+	}
+	done <- struct{}{}
+	<-done
+	if n := l.Retrying("a"); n != 0 {
+		t.Fatalf("got %d runs retrying a after they ended, want 0", n)
+	}
+	// dependencies are forgotten once no run is retrying them.
+	if n := len(l.deps); n != 0 {
+		t.Fatalf("got %d dependencies tracked after every run ended, want 0", n)
+	}
+}
+
+func TestDependencyLimiterQueue(t *testing.T) {
+	const limit = 2
+	l := NewDependencyLimiter(limit, false)
+	var (
+		mu     sync.Mutex
+		active = map[string]int{}
+		peak   = map[string]int{}
+		wg     sync.WaitGroup
+	)
+	for i := range 20 {
+		name := []string{"a", "b"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := FnCtx(context.Background(), func(ctx context.Context) error {
+				if GetStatus(ctx).TryNumber == 1 {
+					return errors.New("down")
+				}
+				mu.Lock()
+				active[name]++
+				peak[name] = max(peak[name], active[name])
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				active[name]--
+				mu.Unlock()
+				return nil
+			}, NoDelay(), ForDependency(name, l))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for name, n := range peak {
+		if n > limit {
+			t.Fatalf("got %d runs retrying %s at once, want at most %d", n, name, limit)
+		}
+	}
+
+	// queued runs end when their context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	hold := make(chan struct{})
+	go func() {
+		for range limit {
+			go FnCtx(context.Background(), func(ctx context.Context) error {
+				if GetStatus(ctx).TryNumber == 1 {
+					return errors.New("down")
+				}
+				<-hold
+				return nil
+			}, NoDelay(), ForDependency("a", l))
+		}
+	}()
+	for l.Retrying("a") < limit {
+		time.Sleep(time.Millisecond)
+	}
+	err := FnCtx(ctx, func(context.Context) error {
+		cancel()
+		return errors.New("down")
+	}, NoDelay(), ForDependency("a", l))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want cancellation while queued", err)
+	}
+
+	// and when they are told to shut down.
+	shutdown := make(chan struct{})
+	err = FnCtx(context.Background(), func(context.Context) error {
+		close(shutdown)
+		return errors.New("down")
+	}, NoDelay(), ForDependency("a", l), OnShutdown(shutdown))
+	if !Halted(err) || !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("got %v, want halted ErrShuttingDown while queued", err)
+	}
+	close(hold)
+}
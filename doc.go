@@ -16,16 +16,17 @@ To this end, it has the following features:
 
 The following function types are supported:
 
-	|           Function Signature           |   Retry Method(s)    |
-	|----------------------------------------|----------------------|
-	| func() error                           | Fn                   |
-	| func()(OUT, error)                     | FnOut                |
-	| func(IN) error                         | FnIn, FnInRefr       |
-	| func(IN) (OUT, error)                  | FnIO, FnIORefr       |
-	| func(context.Context) error            | FnCtx                |
-	| func(context.Context)(OUT, error)      | FnOutCtx             |
-	| func(context.Context, IN) error        | FnInCtx, FnInCtxRefr |
-	| func(context.Context, IN) (OUT, error) | FnIOCtx, FnIOCtxRefr |
+	|           Function Signature           |           Retry Method(s)            |
+	|----------------------------------------|--------------------------------------|
+	| func() error                           | Fn                                   |
+	| func()(OUT, error)                     | FnOut                                |
+	| func(IN) error                         | FnIn, FnInRefr                       |
+	| func(IN) (OUT, error)                  | FnIO, FnIORefr                       |
+	| func(context.Context) error            | FnCtx                                |
+	| func(context.Context)(OUT, error)      | FnOutCtx                             |
+	| func(context.Context)(A, B, error)     | FnOut2Ctx                            |
+	| func(context.Context, IN) error        | FnInCtx, FnInCtxRefr, FnInCtxRefrCtx |
+	| func(context.Context, IN) (OUT, error) | FnIOCtx, FnIOCtxRefr, FnIOCtxRefrCtx |
 
 # Retry Workflow
 
@@ -1,10 +1,142 @@
 package redo
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
 )
 
+// ErrOffline is the error that a run will be halted with if the check set with
+// [SkipIfOffline] does not report being online before its timeout.
+var ErrOffline = errors.New("redo: offline")
+
+// ErrLoadShed is the error that a run will be halted with, wrapping the error
+// from the last try, if the function set with [LoadShed] reports that the
+// process is overloaded.
+var ErrLoadShed = errors.New("redo: load shed")
+
+// ErrDependencyBusy is the error that a run will be halted with, wrapping the
+// error from its first try, if the [*DependencyLimiter] set with
+// [ForDependency] sheds it.
+var ErrDependencyBusy = errors.New("redo: dependency busy")
+
+// ErrShuttingDown is the error that a run will be halted with, wrapping the
+// error from the last try, if any, once the channel set with [OnShutdown] is
+// closed.
+var ErrShuttingDown = errors.New("redo: shutting down")
+
+// ErrNoFinalValue is returned with the zero value by the retriers that return a
+// value, such as [FnOutCtx], if the run succeeds through a function set with
+// [FinalAttempt], which has no value to return, so that the zero value is not
+// mistaken for a result. Use [FinalAttemptOut] to return one.
+var ErrNoFinalValue = errors.New("redo: final attempt succeeded without a value")
+
+// ErrUnbounded is returned without running the function if [RequireBoundedRun]
+// is set and nothing would ever end the run other than success or a halt.
+var ErrUnbounded = errors.New("redo: unbounded run: no MaxTries, MaxElapsed or context deadline")
+
+// terminalIOErrs are the errors recognized by [HaltOnTerminalIO].
+var terminalIOErrs = []error{io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe, net.ErrClosed}
+
+// HaltOnTerminalIO returns a function for use with [HaltFn] that reports true
+// for errors that signal the end of a stream or a closed connection, which
+// retrying will not fix. It recognizes, including when wrapped:
+//
+//   - [io.EOF]
+//   - [io.ErrUnexpectedEOF]
+//   - [io.ErrClosedPipe]
+//   - [net.ErrClosed]
+//
+// It can be combined with other checks by calling it from a larger halt
+// function:
+//
+//	isTerminal := redo.HaltOnTerminalIO()
+//	redo.HaltFn(func(err error) bool {
+//	    return isTerminal(err) || errors.Is(err, ErrForbidden)
+//	})
+func HaltOnTerminalIO() func(error) bool {
+	return func(e error) bool {
+		for _, target := range terminalIOErrs {
+			if errors.Is(e, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Reason is the reason a run ended, as reported by [ReasonOf].
+type Reason int
+
+const (
+	// ReasonUnknown is for errors not returned by a retrier, or that ended the
+	// run for a reason not covered below.
+	ReasonUnknown Reason = iota
+	// ReasonSuccess is for a nil error, from a successful run.
+	ReasonSuccess
+	// ReasonExhausted is for errors for which [Exhausted] returns true.
+	ReasonExhausted
+	// ReasonHalted is for errors for which [Halted] returns true.
+	ReasonHalted
+	// ReasonRefreshFailed is for errors for which [RefreshFailed] returns true.
+	ReasonRefreshFailed
+	// ReasonCanceled is for runs ended by their context being cancelled or its
+	// deadline being exceeded.
+	ReasonCanceled
+)
+
+// String implements fmt.Stringer
+func (r Reason) String() string {
+	switch r {
+	case ReasonUnknown:
+		return "ReasonUnknown"
+	case ReasonSuccess:
+		return "ReasonSuccess"
+	case ReasonExhausted:
+		return "ReasonExhausted"
+	case ReasonHalted:
+		return "ReasonHalted"
+	case ReasonRefreshFailed:
+		return "ReasonRefreshFailed"
+	case ReasonCanceled:
+		return "ReasonCanceled"
+	}
+	return "Reason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// ReasonOf returns the reason a run ended with err, so that callers can handle
+// every outcome with a single switch rather than a series of checks:
+//
+//	switch redo.ReasonOf(err) {
+//	case redo.ReasonSuccess:
+//	case redo.ReasonHalted:
+//	    // ...
+//	}
+//
+// It reports ReasonCanceled for errors that are or wrap [context.Canceled] or
+// [context.DeadlineExceeded]. If the context was given a cause, and it does not
+// wrap either of those, it is reported as ReasonUnknown, so use [CtxCause] to
+// disable cause extraction if that matters.
+func ReasonOf(err error) Reason {
+	switch {
+	case err == nil:
+		return ReasonSuccess
+	case Exhausted(err):
+		return ReasonExhausted
+	case Halted(err):
+		return ReasonHalted
+	case RefreshFailed(err):
+		return ReasonRefreshFailed
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ReasonCanceled
+	}
+	return ReasonUnknown
+}
+
 // Exhausted returns true if the error is the final result after all tries.
 func Exhausted(e error) bool {
 	_, ok := e.(*exhaustedErr)
@@ -12,10 +144,15 @@ func Exhausted(e error) bool {
 }
 
 type exhaustedErr struct {
-	err error
+	err    error
+	status Status
+	format func(error, Status) string
 }
 
 func (ee *exhaustedErr) Error() string {
+	if ee.format != nil {
+		return ee.format(ee.err, ee.status)
+	}
 	return ee.err.Error()
 }
 
@@ -23,12 +160,23 @@ func (ee *exhaustedErr) Unwrap() error {
 	return ee.err
 }
 
-func errExhausted(e error) *exhaustedErr {
-	return &exhaustedErr{e}
+// Progress returns the last fraction set with [SetProgress] during the run, or
+// 0 if none was set. See [LastProgress].
+func (ee *exhaustedErr) Progress() float64 {
+	f, _ := LastProgress(ee)
+	return f
+}
+
+func errExhausted(e error, status Status, format func(error, Status) string) *exhaustedErr {
+	return &exhaustedErr{err: e, status: status, format: format}
 }
 
 type haltErr struct {
-	err error
+	err        error
+	retryAfter time.Duration
+	hasHint    bool
+	value      any
+	hasValue   bool
 }
 
 func (he *haltErr) Error() string {
@@ -39,6 +187,70 @@ func (he *haltErr) Unwrap() error {
 	return he.err
 }
 
+type retryAfterErr struct {
+	err   error
+	after time.Duration
+}
+
+func (re *retryAfterErr) Error() string {
+	return re.err.Error()
+}
+
+func (re *retryAfterErr) Unwrap() error {
+	return re.err
+}
+
+// retryAfterOf returns the delay requested with RetryAfter, if err or any error
+// it wraps was created with it.
+func retryAfterOf(e error) (time.Duration, bool) {
+	var re *retryAfterErr
+	if errors.As(e, &re) {
+		return re.after, true
+	}
+	return 0, false
+}
+
+// RefreshFailed returns true if the error, or any error it wraps, is a
+// [*RefreshError], meaning that the run ended because a [RefreshFn] failed.
+func RefreshFailed(e error) bool {
+	var re *RefreshError
+	return errors.As(e, &re)
+}
+
+// Cause returns the underlying error of an error returned by a retrier, by
+// removing any of the package's own wrappers, such as those added on
+// exhaustion or by [Halt], however deeply they are nested. For a
+// [*RefreshError], it returns the error that caused the retry, rather than the
+// error from the refresh function. Errors that were not wrapped by the package
+// are returned as they are, so it is always safe to call. It is similar in
+// spirit to [context.Cause].
+func Cause(e error) error {
+	for {
+		switch err := e.(type) {
+		case *exhaustedErr:
+			e = err.err
+		case *haltErr:
+			e = err.err
+		case *retryAfterErr:
+			e = err.err
+		case *RefreshError:
+			e = err.retryErr
+		default:
+			return e
+		}
+	}
+}
+
+// RetryAfterHint returns the duration recorded with [HaltRetryAfter] or
+// [RetryAfter], if err or any error it wraps was created with either.
+func RetryAfterHint(e error) (time.Duration, bool) {
+	var he *haltErr
+	if errors.As(e, &he) && he.hasHint {
+		return he.retryAfter, true
+	}
+	return retryAfterOf(e)
+}
+
 // RefreshError will be returned if a [RefreshFn] returns an error. The
 // underlying error that caused the retry will be combined with this error using
 // [errors.Join].
@@ -72,3 +284,12 @@ func errRefresh(refreshErr, retryErr error) *RefreshError {
 		retryErr: retryErr,
 	}
 }
+
+// shuttingDown returns the error to halt a run with for OnShutdown, given the
+// error from its last try.
+func shuttingDown(lastErr error) error {
+	if lastErr == nil {
+		return Halt(ErrShuttingDown)
+	}
+	return Halt(fmt.Errorf("%w: %w", ErrShuttingDown, lastErr))
+}
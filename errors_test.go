@@ -0,0 +1,271 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterHint(t *testing.T) {
+	errLimited := errors.New("rate limited")
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return HaltRetryAfter(errLimited, 5*time.Minute)
+	})
+	if !Halted(err) {
+		t.Fatalf("expected halted error, got %v", err)
+	}
+	if !errors.Is(err, errLimited) {
+		t.Fatalf("expected %v to wrap %v", err, errLimited)
+	}
+	after, ok := RetryAfterHint(fmt.Errorf("wrapped: %w", err))
+	if !ok || after != 5*time.Minute {
+		t.Fatalf("got hint %v, %v; want %v, true", after, ok, 5*time.Minute)
+	}
+
+	if _, ok := RetryAfterHint(Halt(errLimited)); ok {
+		t.Fatal("got hint from plain halt error")
+	}
+	if _, ok := RetryAfterHint(errLimited); ok {
+		t.Fatal("got hint from non-redo error")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	errBusy := errors.New("busy")
+	clk := newFakeClock(time.Time{})
+	var delays []time.Duration
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		if GetStatus(ctx).TryNumber == 1 {
+			return RetryAfter(errBusy, time.Hour)
+		}
+		return errBusy
+	},
+		InitialDelay(time.Millisecond),
+		MaxDelay(time.Second),
+		MaxTries(3),
+		withClock(clk),
+		Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+	)
+	if delays[0] != time.Hour || delays[1] > time.Second {
+		t.Fatalf("got delays %v, want 1h then the usual backoff", delays)
+	}
+	if !Exhausted(err) || !errors.Is(err, errBusy) || Cause(err) != errBusy {
+		t.Fatalf("got %v, want exhausted with %v", err, errBusy)
+	}
+
+	// the hint survives to the end of the run.
+	err = FnCtx(context.Background(), func(context.Context) error {
+		return RetryAfter(errBusy, time.Minute)
+	}, MaxTries(1))
+	if after, ok := RetryAfterHint(err); !ok || after != time.Minute {
+		t.Fatalf("got hint %v, %v; want 1m, true", after, ok)
+	}
+}
+
+func TestHaltValue(t *testing.T) {
+	errPartial := errors.New("partial")
+	got, err := FnOutCtx(context.Background(), func(context.Context) ([]int, error) {
+		return nil, HaltValue([]int{1, 2}, errPartial)
+	})
+	if !Halted(err) || !errors.Is(err, errPartial) {
+		t.Fatalf("expected halted error, got %v", err)
+	}
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("got %v, want [1 2]", got)
+	}
+
+	got2, err := FnIOCtx(context.Background(), func(context.Context, int) (string, error) {
+		return "", HaltValue("half", errPartial)
+	}, 0)
+	if got2 != "half" || !Halted(err) {
+		t.Fatalf("got %q, %v; want half, halted", got2, err)
+	}
+
+	// a value of the wrong type is ignored.
+	got3, err := FnOutCtx(context.Background(), func(context.Context) (int, error) {
+		return 1, HaltValue("one", errPartial)
+	})
+	if got3 != 0 || !Halted(err) {
+		t.Fatalf("got %v, %v; want 0, halted", got3, err)
+	}
+	if v, ok := HaltedValue[string](fmt.Errorf("wrapped: %w", err)); !ok || v != "one" {
+		t.Fatalf("got value %q, %v; want one, true", v, ok)
+	}
+	if _, ok := HaltedValue[string](Halt(errPartial)); ok {
+		t.Fatal("got value from plain halt error")
+	}
+}
+
+func TestExhaustedFormat(t *testing.T) {
+	errFail := errors.New("fail")
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errFail
+	}, InitialDelay(time.Millisecond), MaxTries(3), ExhaustedFormat(func(err error, s Status) string {
+		return fmt.Sprintf("%v (after %d tries)", err, s.TryNumber)
+	}))
+	if got, want := err.Error(), "fail (after 3 tries)"; got != want {
+		t.Fatalf("got message %q, want %q", got, want)
+	}
+	if !Exhausted(err) || !errors.Is(err, errFail) {
+		t.Fatalf("expected exhausted error wrapping %v, got %v", errFail, err)
+	}
+}
+
+func TestCause(t *testing.T) {
+	errRoot := errors.New("root")
+	wrapped := fmt.Errorf("wrapped: %w", errRoot)
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"plain", errRoot, errRoot},
+		{"foreign wrapper", wrapped, wrapped},
+		{"exhausted", errExhausted(errRoot, Status{}, nil), errRoot},
+		{"halted", Halt(errRoot), errRoot},
+		{"refresh", errRefresh(errors.New("refresh failed"), errRoot), errRoot},
+		{"halted exhausted", Halt(errExhausted(wrapped, Status{}, nil)), wrapped},
+		{"exhausted refresh", errExhausted(errRefresh(errors.New("refresh failed"), Halt(errRoot)), Status{}, nil), errRoot},
+	}
+	for _, tt := range tests {
+		if got := Cause(tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshFailed(t *testing.T) {
+	errRefreshFailed := errors.New("refresh failed")
+	errFail := errors.New("fail")
+	tries := 0
+	err := FnInRefr(context.Background(), func(int) error {
+		tries++
+		return errFail
+	}, func() (int, error) {
+		return 0, errRefreshFailed
+	}, 0)
+	if !RefreshFailed(err) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want a refresh failure after 1", err, tries)
+	}
+	var re *RefreshError
+	if !errors.As(err, &re) || re.RetryErr() != errFail {
+		t.Fatalf("got %v, want a *RefreshError with retry error %v", err, errFail)
+	}
+
+	exhausted := FnCtx(context.Background(), func(context.Context) error {
+		return errFail
+	}, InitialDelay(time.Millisecond), MaxTries(1))
+	if RefreshFailed(exhausted) || RefreshFailed(Halt(errFail)) || RefreshFailed(nil) {
+		t.Fatal("got a refresh failure for an error without a *RefreshError")
+	}
+}
+
+func TestRefreshCtxCancelled(t *testing.T) {
+	errShutdown := errors.New("shutting down")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	refreshing := make(chan struct{})
+	go func() {
+		<-refreshing
+		cancel(errShutdown)
+	}()
+	out, err := FnIOCtxRefrCtx(ctx, func(context.Context, int) (string, error) {
+		return "", errors.New("fail")
+	}, 0, func(ctx context.Context) (int, error) {
+		close(refreshing)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if err != errShutdown || RefreshFailed(err) || out != "" {
+		t.Fatalf("got %q, %v; want the cancellation cause %v", out, err, errShutdown)
+	}
+
+	// a refresh failure with a live context is still a *RefreshError.
+	errRefreshFailed := errors.New("refresh failed")
+	err = FnInCtxRefrCtx(context.Background(), func(context.Context, int) error {
+		return errors.New("fail")
+	}, 0, func(context.Context) (int, error) {
+		return 0, errRefreshFailed
+	})
+	if !RefreshFailed(err) || !errors.Is(err, errRefreshFailed) {
+		t.Fatalf("got %v, want a refresh failure", err)
+	}
+}
+
+func TestHaltOnTerminalIO(t *testing.T) {
+	isTerminal := HaltOnTerminalIO()
+	for _, target := range []error{io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe, net.ErrClosed} {
+		if !isTerminal(fmt.Errorf("read: %w", target)) {
+			t.Errorf("expected wrapped %v to be terminal", target)
+		}
+	}
+	for _, e := range []error{nil, errors.New("timeout"), context.Canceled} {
+		if isTerminal(e) {
+			t.Errorf("expected %v not to be terminal", e)
+		}
+	}
+
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return fmt.Errorf("stream: %w", io.EOF)
+	}, HaltFn(isTerminal))
+	if !Halted(err) || !errors.Is(err, io.EOF) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want halted io.EOF after 1", err, tries)
+	}
+}
+
+func TestReasonOf(t *testing.T) {
+	errFail := errors.New("fail")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		err  error
+		want Reason
+	}{
+		{"success", nil, ReasonSuccess},
+		{"exhausted", FnCtx(context.Background(), func(context.Context) error {
+			return errFail
+		}, NoDelay(), MaxTries(2)), ReasonExhausted},
+		{"halted", FnCtx(context.Background(), func(context.Context) error {
+			return Halt(errFail)
+		}), ReasonHalted},
+		{"refresh failed", FnInRefr(context.Background(), func(int) error {
+			return errFail
+		}, func() (int, error) {
+			return 0, errors.New("refresh failed")
+		}, 0), ReasonRefreshFailed},
+		{"canceled", FnCtx(cancelled, func(ctx context.Context) error {
+			return ctx.Err()
+		}), ReasonCanceled},
+		{"deadline", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), ReasonCanceled},
+		{"unknown", errFail, ReasonUnknown},
+	}
+	for _, tt := range tests {
+		if got := ReasonOf(tt.err); got != tt.want {
+			t.Errorf("%s: got %v for %v, want %v", tt.name, got, tt.err, tt.want)
+		}
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	tests := map[Reason]string{
+		ReasonUnknown:       "ReasonUnknown",
+		ReasonSuccess:       "ReasonSuccess",
+		ReasonExhausted:     "ReasonExhausted",
+		ReasonHalted:        "ReasonHalted",
+		ReasonRefreshFailed: "ReasonRefreshFailed",
+		ReasonCanceled:      "ReasonCanceled",
+		Reason(42):          "Reason(42)",
+	}
+	for r, want := range tests {
+		if got := r.String(); got != want {
+			t.Errorf("got %q for %d, want %q", got, int(r), want)
+		}
+	}
+}
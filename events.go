@@ -0,0 +1,100 @@
+package redo
+
+import (
+	"context"
+	"iter"
+	"strconv"
+)
+
+// EventKind identifies the point in a run that an [Event] was produced at.
+type EventKind int
+
+const (
+	// AttemptStarted is produced directly before each call to the function.
+	AttemptStarted EventKind = iota + 1
+	// AttemptFailed is produced after each failed call, before any halt or
+	// exhaustion checks, at the same time [Each] is called.
+	AttemptFailed
+	// Sleeping is produced before each delay between tries, with the planned
+	// delay in Status.NextDelay.
+	Sleeping
+	// Succeeded is the final event of a successful run.
+	Succeeded
+	// GaveUp is the final event of a run that ended with an error, for any
+	// reason.
+	GaveUp
+)
+
+// String implements fmt.Stringer
+func (k EventKind) String() string {
+	switch k {
+	case AttemptStarted:
+		return "AttemptStarted"
+	case AttemptFailed:
+		return "AttemptFailed"
+	case Sleeping:
+		return "Sleeping"
+	case Succeeded:
+		return "Succeeded"
+	case GaveUp:
+		return "GaveUp"
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Event describes a step in a run observed with [FnEvents].
+type Event struct {
+	Kind EventKind
+	// Status is the status of the try the event belongs to. For Succeeded and
+	// GaveUp, it is the status of the last try.
+	Status Status
+	// Err is the error from the failed try for AttemptFailed, and the final
+	// result of the run for GaveUp. It is nil otherwise.
+	Err error
+}
+
+// FnEvents retries fn as with [FnCtx], but exposes the run as a sequence of
+// events instead of a single result, for integrations that want to observe
+// every step without setting several callbacks.
+//
+// Nothing runs until the sequence is iterated over, and the run happens as it
+// is consumed: each event is yielded from within the retry loop, so the next
+// try will not start until the loop body for the previous event returns. The
+// last event is always Succeeded or GaveUp, the latter with the error the run
+// ended with. Breaking out of the loop early cancels the run's context and
+// waits for the current try to return, after which no more events are yielded.
+// Iterating over the sequence again starts a new run.
+func FnEvents(ctx context.Context, fn func(context.Context) error, options ...Option) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var (
+			last    Status
+			stopped bool
+		)
+		emit := func(e Event) {
+			last = e.Status
+			if !stopped && !yield(e) {
+				stopped = true
+				cancel()
+			}
+		}
+		// clip options so that the caller's slice is never appended to.
+		err := FnCtx(ctx, fn, append(options[:len(options):len(options)], func(o *opts) { o.eventFn = emit })...)
+		if stopped {
+			return
+		}
+		if err != nil {
+			yield(Event{Kind: GaveUp, Status: last, Err: err})
+			return
+		}
+		yield(Event{Kind: Succeeded, Status: last})
+	}
+}
+
+// emit sends an event to the observer set by FnEvents, if any.
+func (o *opts) emit(kind EventKind, status Status, err error) {
+	if o.eventFn != nil {
+		o.eventFn(Event{Kind: kind, Status: status, Err: err})
+	}
+}
@@ -0,0 +1,68 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFnEvents(t *testing.T) {
+	errFail := errors.New("fail")
+	tries := 0
+	var kinds []EventKind
+	var final Event
+	for e := range FnEvents(context.Background(), func(context.Context) error {
+		tries++
+		if tries < 3 {
+			return errFail
+		}
+		return nil
+	}, NoDelay()) {
+		kinds = append(kinds, e.Kind)
+		if e.Kind == AttemptFailed && !errors.Is(e.Err, errFail) {
+			t.Errorf("got error %v for failed attempt, want %v", e.Err, errFail)
+		}
+		final = e
+	}
+	want := []EventKind{
+		AttemptStarted, AttemptFailed, Sleeping,
+		AttemptStarted, AttemptFailed, Sleeping,
+		AttemptStarted, Succeeded,
+	}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("got events %v, want %v", kinds, want)
+	}
+	if final.Status.TryNumber != 3 || final.Err != nil {
+		t.Fatalf("got final event %+v, want success on try 3", final)
+	}
+}
+
+func TestFnEventsGaveUp(t *testing.T) {
+	var final Event
+	for e := range FnEvents(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	}, NoDelay(), MaxTries(2)) {
+		final = e
+	}
+	if final.Kind != GaveUp || !Exhausted(final.Err) || final.Status.TryNumber != 2 {
+		t.Fatalf("got final event %v on try %d (%v), want exhausted GaveUp on try 2", final.Kind, final.Status.TryNumber, final.Err)
+	}
+}
+
+func TestFnEventsBreak(t *testing.T) {
+	tries := 0
+	events := 0
+	for e := range FnEvents(context.Background(), func(context.Context) error {
+		tries++
+		return errors.New("fail")
+	}, NoDelay()) {
+		events++
+		if e.Kind == AttemptFailed {
+			break
+		}
+	}
+	if tries != 1 || events != 2 {
+		t.Fatalf("got %d tries and %d events after break, want 1 and 2", tries, events)
+	}
+}
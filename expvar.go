@@ -0,0 +1,44 @@
+package redo
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	expvarMu   sync.Mutex
+	expvarMaps = map[string]*expvar.Map{}
+)
+
+// PublishExpvar counts the runs made with this option in an [expvar.Map]
+// published under name, so that retry activity can be seen at /debug/vars
+// without a metrics backend. The map holds the counters "runs", "attempts",
+// "successes" and "give_ups". Runs using the same name share the same map, so
+// it is safe to create the option any number of times, while different names
+// are counted separately. If name is already published by something other than
+// this option, it will panic if that is not an *expvar.Map, and otherwise the
+// counters are added to it.
+func PublishExpvar(name string) Option {
+	m := expvarMap(name)
+	return func(o *opts) {
+		o.expvars = m
+	}
+}
+
+// expvarMap returns the map published under name, publishing it first if
+// needed.
+func expvarMap(name string) *expvar.Map {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if m, ok := expvarMaps[name]; ok {
+		return m
+	}
+	var m *expvar.Map
+	if v := expvar.Get(name); v != nil {
+		m = v.(*expvar.Map)
+	} else {
+		m = expvar.NewMap(name)
+	}
+	expvarMaps[name] = m
+	return m
+}
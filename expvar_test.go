@@ -0,0 +1,51 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	counters := func(name string) map[string]int64 {
+		m, _ := expvar.Get(name).(*expvar.Map)
+		got := map[string]int64{}
+		if m != nil {
+			m.Do(func(kv expvar.KeyValue) {
+				got[kv.Key] = kv.Value.(*expvar.Int).Value()
+			})
+		}
+		return got
+	}
+	// counters accumulate for the life of the process, so compare deltas.
+	beforeA, beforeB, beforeC := counters("redo_test_a"), counters("redo_test_b"), counters("redo_test_c")
+
+	fail := func(context.Context) error { return errors.New("fail") }
+	succeed := func(context.Context) error { return nil }
+	_ = FnCtx(context.Background(), fail, NoDelay(), MaxTries(3), PublishExpvar("redo_test_a"))
+	_ = FnCtx(context.Background(), succeed, PublishExpvar("redo_test_a"))
+	_ = FnCtx(context.Background(), succeed, PublishExpvar("redo_test_b"))
+	_ = FnCtx(context.Background(), fail, NoDelay(), MaxTries(2), FinalAttempt(succeed), PublishExpvar("redo_test_c"))
+
+	tests := []struct {
+		name   string
+		before map[string]int64
+		want   map[string]int64
+	}{
+		{"redo_test_a", beforeA, map[string]int64{"runs": 2, "attempts": 4, "successes": 1, "give_ups": 1}},
+		{"redo_test_b", beforeB, map[string]int64{"runs": 1, "attempts": 1, "successes": 1, "give_ups": 0}},
+		{"redo_test_c", beforeC, map[string]int64{"runs": 1, "attempts": 3, "successes": 1, "give_ups": 0}},
+	}
+	for _, tt := range tests {
+		if expvar.Get(tt.name) == nil {
+			t.Fatalf("%s was not published", tt.name)
+		}
+		after := counters(tt.name)
+		for key, want := range tt.want {
+			if got := after[key] - tt.before[key]; got != want {
+				t.Errorf("%s %s: got %d, want %d", tt.name, key, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// WaitForFile retries [os.Stat] on path until the file exists. Only
+// [fs.ErrNotExist] is retried; any other error, such as a permission error,
+// will halt the run immediately. The options are the same as for any other
+// retrier, so the run will end as usual if it is exhausted or ctx is
+// cancelled.
+func WaitForFile(ctx context.Context, path string, options ...Option) error {
+	return Fn(ctx, func() error {
+		_, err := os.Stat(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return Halt(err)
+		}
+		return err
+	}, options...)
+}
@@ -0,0 +1,49 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	tries := 0
+	err := WaitForFile(context.Background(), path, InitialDelay(time.Millisecond), Each(func(Status) {
+		tries++
+		if tries == 2 {
+			if err := os.WriteFile(path, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tries != 2 {
+		t.Fatalf("got %d failed tries, want 2", tries)
+	}
+
+	err = WaitForFile(context.Background(), filepath.Join(t.TempDir(), "never"), InitialDelay(time.Millisecond), MaxTries(2))
+	if !Exhausted(err) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want exhausted fs.ErrNotExist", err)
+	}
+}
+
+func TestWaitForFileHalts(t *testing.T) {
+	// a path through a regular file fails with an error other than
+	// fs.ErrNotExist, even when running as root.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tries := 0
+	err := WaitForFile(context.Background(), filepath.Join(file, "child"), Each(func(Status) { tries++ }))
+	if !Halted(err) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want a halt after 1", err, tries)
+	}
+}
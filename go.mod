@@ -1,3 +1,3 @@
 module andy.dev/redo
 
-go 1.22
+go 1.23
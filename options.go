@@ -1,8 +1,17 @@
 package redo
 
 import (
+	"context"
 	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
 	"time"
+
+	"andy.dev/redo/backoff"
 )
 
 // Option represents an optional retry setting.
@@ -19,6 +28,7 @@ func WithPolicy(p Policy) Option {
 		o.haltFn = p.Halt
 		o.eachFn = p.Each
 		o.noCause = p.NoCtxCause
+		o.maxElapsed = p.MaxElapsed
 	}
 }
 
@@ -31,6 +41,18 @@ func InitialDelay(duration time.Duration) Option {
 	}
 }
 
+// InitialDelayJitter moves the initial delay of each run by a random amount
+// within ±spread, so that many instances starting at once and retrying the same
+// dependency are staggered along the whole curve, rather than only at each
+// step, as with the backoff's own jitter. The jittered delay is never less
+// than [MinDelay]. It uses the random source set with [Rand], if any. Defaults
+// to 0, which does not move the initial delay.
+func InitialDelayJitter(spread time.Duration) Option {
+	return func(o *opts) {
+		o.initialJitter = spread
+	}
+}
+
 // MaxDelay will cap the exponential delay to a maximum value. If this is <=
 // 0, it will default to DefaultMaxDelay (20 * time.Minutes) or
 // InitialDelay, whichever is greater.
@@ -40,6 +62,44 @@ func MaxDelay(duration time.Duration) Option {
 	}
 }
 
+// MaxDelayRange will cap the exponential delay to a value chosen at random
+// from [min, max] at the start of each run, so that a fleet of clients retrying
+// the same failure will not all plateau at the same delay. It overrides
+// [MaxDelay]. It will panic if min is negative or greater than max.
+func MaxDelayRange(min, max time.Duration) Option {
+	if min < 0 || min > max {
+		panic("redo: MaxDelayRange requires 0 <= min <= max")
+	}
+	return func(o *opts) {
+		o.maxDelayRange = [2]time.Duration{min, max}
+	}
+}
+
+// MaxDelayFactor will cap the exponential delay to n times the initial delay,
+// which keeps the shape of the curve the same when only [InitialDelay] is
+// tuned. [MaxDelay] and [MaxDelayRange] take precedence over it if either is
+// set. It will panic if n is less than 1.
+func MaxDelayFactor(n float64) Option {
+	if !(n >= 1) {
+		panic("redo: MaxDelayFactor requires n >= 1")
+	}
+	return func(o *opts) {
+		o.maxDelayFactor = n
+	}
+}
+
+// QuantizeDelay rounds each delay up to the nearest multiple of quantum, which
+// can be used to align retries with a scheduler that runs on fixed ticks. The
+// delay is quantized before it is capped by [MaxDelay], so if MaxDelay is not
+// itself a multiple of quantum, delays at the cap will not be either. The
+// quantized delay is reported in [Status].NextDelay. Defaults to 0, which
+// leaves delays as they are.
+func QuantizeDelay(quantum time.Duration) Option {
+	return func(o *opts) {
+		o.quantum = quantum
+	}
+}
+
 // MaxTries is the number of tries to attempt. A negative value will retry
 // until explicitly cancelled via context or a call to [Halt]. If unset, it
 // will default to DefaultMaxTries (10)
@@ -49,6 +109,206 @@ func MaxTries(tries int) Option {
 	}
 }
 
+// StartAttempt resumes the try count at n, for a run that continues one that
+// was interrupted, such as by a restart, so that [Status].TryNumber and
+// [MaxTries] reflect the total number of tries across both. The first try of
+// the run will be numbered n, and the backoff will be advanced to match, but
+// since the delays are randomized, they will not be exactly those the
+// interrupted run would have used. If n is already past MaxTries, the run
+// will make a single try. Defaults to 1.
+func StartAttempt(n int) Option {
+	return func(o *opts) {
+		o.startAttempt = n
+	}
+}
+
+// MaxElapsed limits the total time a run may take. A try will not be started
+// after the budget has elapsed, so if the delay before the next try would take
+// the run past it, the run ends after the current try and is exhausted, just
+// as if it had run out of tries. The budget is measured from the start of the
+// run, and does not interrupt a try in progress; use a context deadline for
+// that. Defaults to 0, which sets no limit.
+func MaxElapsed(budget time.Duration) Option {
+	return func(o *opts) {
+		o.maxElapsed = budget
+	}
+}
+
+// MaxElapsedJitter randomizes the [MaxElapsed] budget of each run by up to
+// spread in either direction, so that a fleet of clients that began retrying
+// at the same time will not all give up at the same moment. The jittered
+// budget will never be less than half of MaxElapsed. It has no effect if
+// MaxElapsed is not set.
+func MaxElapsedJitter(spread time.Duration) Option {
+	return func(o *opts) {
+		o.maxElapsedJitter = spread
+	}
+}
+
+// ContextValueFunc sets a value under key in the context passed to each try,
+// made fresh for every try by calling gen with its [Status].TryNumber, such as
+// a nonce or idempotency token:
+//
+//	redo.ContextValueFunc(nonceKey{}, func(int) any {
+//	    return rand.Uint64()
+//	})
+//
+// It can be given more than once to set several values, which are set in the
+// order given, so a later value for the same key shadows an earlier one. As
+// with [context.WithValue], key must be comparable and should be of a type of
+// your own. The package's own context keys are unexported, so they cannot be
+// overwritten. Defaults to setting no values.
+func ContextValueFunc(key any, gen func(try int) any) Option {
+	return func(o *opts) {
+		o.ctxValues = append(o.ctxValues, ctxValue{key: key, gen: gen})
+	}
+}
+
+// ctxValue is a value set with ContextValueFunc.
+type ctxValue struct {
+	key any
+	gen func(try int) any
+}
+
+// DisableStatusContext passes the context given to the retrier directly to the
+// function, instead of deriving a new one holding the [Status] of each try. This
+// saves an allocation per try on hot paths where the function never looks at
+// its status, but [GetStatus] will return Status{}, [Retrying] will return
+// false and [AttemptID] will return "" from within the function. [Each] and
+// the other callbacks are unaffected.
+func DisableStatusContext() Option {
+	return func(o *opts) {
+		o.noStatusCtx = true
+	}
+}
+
+// AutoTriesFromDeadline will, if the context has a deadline and [MaxTries] is
+// not set, derive the number of tries from the deadline instead of using
+// DefaultMaxTries, so that the run fits the time available rather than being
+// cut off by the deadline. The number of tries is an estimate, based on the
+// median delays of the backoff, and does not account for the time taken by
+// the tries themselves. Defaults to false.
+func AutoTriesFromDeadline(enabled bool) Option {
+	return func(o *opts) {
+		o.autoTries = enabled
+	}
+}
+
+// BudgetFromFirstLatency adapts the number of tries to how slow the function
+// is, so that a slow dependency does not get the full [MaxTries]. If the first
+// try fails, its latency is used to estimate how many more tries, and the
+// median delays between them, will fit in what is left of target since the
+// start of the run, and MaxTries is lowered to match if it is larger. This is
+// a heuristic which assumes every try takes as long as the first, and it
+// never raises MaxTries. The adapted MaxTries is reported in [Status].
+// Defaults to 0, which does not adapt the number of tries.
+func BudgetFromFirstLatency(target time.Duration) Option {
+	return func(o *opts) {
+		o.budgetTarget = target
+	}
+}
+
+// RequireBoundedRun guards against runs that could retry forever. If enabled,
+// a retrier called with a negative [MaxTries], no [MaxElapsed] and a context
+// without a deadline will return [ErrUnbounded] immediately, without calling
+// the function. Defaults to false.
+func RequireBoundedRun(enabled bool) Option {
+	return func(o *opts) {
+		o.requireBounded = enabled
+	}
+}
+
+// NoDelay makes every retry immediate, for operations such as optimistic
+// concurrency loops where waiting between tries serves no purpose. The run
+// still yields to other goroutines between tries, and is still subject to
+// [MaxTries], the halting options and context cancellation. [Status].NextDelay
+// will always be zero. Unlike [FirstFast], it applies to every retry, not just
+// the first.
+func NoDelay() Option {
+	return func(o *opts) {
+		o.noDelay = true
+	}
+}
+
+// TaperToEnd shortens the delays before the last few tries of a run with a
+// limited [MaxTries], for latency-sensitive callers who would rather fail fast
+// once success is unlikely than wait out a long delay only to give up. The
+// delays before the last [TaperTries] tries are scaled down linearly, so that
+// they are 3/4, 2/4 and 1/4 of what they would have been. It has no effect if
+// MaxTries is unlimited. Defaults to false.
+func TaperToEnd(enabled bool) Option {
+	return func(o *opts) {
+		o.taperToEnd = enabled
+	}
+}
+
+// InstantFirstRetry makes the retry after the first failure immediate, on the
+// basis that a single failure is often a transient blip, while the retries
+// after any further failures wait using the full backoff, starting from
+// [InitialDelay]. This differs from [FirstFast], which also makes the first
+// retry immediate, but then carries on the curve as if the first delay had
+// been taken, so its second delay is already larger than InitialDelay:
+//
+//	InstantFirstRetry: 0, ~1x, ~2x, ~4x...
+//	FirstFast:         0, ~2x, ~4x, ~8x...
+//
+// If both are set, only the first retry is immediate, and the delays follow
+// FirstFast. Defaults to false.
+func InstantFirstRetry(enabled bool) Option {
+	return func(o *opts) {
+		o.instantFirst = enabled
+	}
+}
+
+// Burst makes the first n retries immediate, for systems that benefit from a
+// quick burst of retries before settling into backoff, after which the backoff
+// carries on from the start of its curve:
+//
+//	Burst(3): 0, 0, 0, ~1x, ~2x, ~4x...
+//
+// The burst retries count towards [MaxTries] as usual. It generalizes
+// [InstantFirstRetry], which is the same as Burst(1), and if both are set the
+// larger burst applies. The immediate retry made by [FirstFast] counts as the
+// first of the burst rather than adding to it, so with both there are still n
+// immediate retries, after which the backoff carries on as it would after
+// FirstFast's. Defaults to 0, which has no burst.
+func Burst(n int) Option {
+	return func(o *opts) {
+		o.burst = n
+	}
+}
+
+// AWSBackoff replaces the default soft exponential backoff with the
+// "decorrelated jitter" algorithm from the AWS Architecture Blog, using
+// [InitialDelay] and [MaxDelay] as its bounds. See [backoff.AWS] for how their
+// delays differ. [FirstFast] still makes the first retry immediate.
+func AWSBackoff() Option {
+	return func(o *opts) {
+		o.awsBackoff = true
+	}
+}
+
+// Backoff replaces the default soft exponential backoff with the delays of the
+// iterator returned by newIterator, such as a schedule recorded from
+// production and replayed with [backoff.FromReader]:
+//
+//	redo.Backoff(func() backoff.Iterator {
+//	    it, _ := backoff.FromReader(strings.NewReader(schedule))
+//	    return it
+//	})
+//
+// newIterator is called at the start of each run, and again whenever the
+// backoff starts over, as with [ResetBackoffOnErrorChange], so it must return
+// a fresh iterator each time. [InitialDelay], [MaxDelay] and [Rand] do not
+// apply to its delays, while [FirstFast] still makes the first retry
+// immediate, and the options that adjust each delay, such as [QuantizeDelay],
+// still apply. Defaults to nil, which uses the default backoff.
+func Backoff(newIterator func() backoff.Iterator) Option {
+	return func(o *opts) {
+		o.newIterator = newIterator
+	}
+}
+
 // FirstFast defines whether or not the first retry should be made
 // immediately. Defaults to false.
 func FirstFast(firstRetryImmediate bool) Option {
@@ -57,6 +317,86 @@ func FirstFast(firstRetryImmediate bool) Option {
 	}
 }
 
+// ResetBackoffOnErrorChange will restart the backoff from the beginning of its
+// curve whenever the error returned from the target function differs from the
+// one returned by the previous try, as determined by equal, on the basis that
+// a different failure is a new problem that should not inherit a long delay.
+// The restarted backoff behaves as it would at the start of a run, including
+// [FirstFast]. Defaults to nil, which never resets the backoff.
+func ResetBackoffOnErrorChange(equal func(a, b error) bool) Option {
+	return func(o *opts) {
+		o.resetEqualFn = equal
+	}
+}
+
+// MaxDistinctErrors halts the run once more than n distinct errors have been
+// returned by the function, on the basis that an error that keeps changing
+// within a few kinds is a sign of progress, while many different errors are a
+// sign of chaotic failure that retrying will not fix. Errors are told apart by
+// the string returned by key, which defaults to the error message if key is
+// nil. To tell them apart by type instead, use:
+//
+//	redo.MaxDistinctErrors(3, func(err error) string {
+//	    return fmt.Sprintf("%T", err)
+//	})
+//
+// Defaults to 0, which does not limit distinct errors.
+func MaxDistinctErrors(n int, key func(error) string) Option {
+	return func(o *opts) {
+		o.maxDistinct = n
+		o.distinctKeyFn = key
+	}
+}
+
+// ExhaustedFormat allows you to customize the message of the error returned
+// when a run is exhausted, which by default is just the message of the last
+// error. formatFn is passed the last error and the [Status] of the final try:
+//
+//	redo.ExhaustedFormat(func(err error, s redo.Status) string {
+//	    return fmt.Sprintf("%v (after %d tries)", err, s.TryNumber)
+//	})
+//
+// Only the message is affected, so [Exhausted], [errors.Is] and [errors.As]
+// will work the same regardless. Defaults to nil.
+func ExhaustedFormat(formatFn func(err error, s Status) string) Option {
+	return func(o *opts) {
+		o.exhaustedFmt = formatFn
+	}
+}
+
+// Validate sets a function that will be called once, before the first try, to
+// check for problems that retrying can never fix, such as a malformed URL. If
+// it returns an error, the run will be halted with that error without calling
+// the target function at all. It is intended only for validation, so it should
+// not have side effects. Defaults to nil.
+func Validate(validateFn func() error) Option {
+	return func(o *opts) {
+		o.validateFn = validateFn
+	}
+}
+
+// MapError allows you to set a function to transform each error returned from
+// the target function before it is used for anything else, such as to redact
+// sensitive data or to add a request ID. The error it returns is the one that
+// will be seen by every other option, [Status], and the caller. Returning nil
+// will end the run as a success. Defaults to nil.
+func MapError(mapFn func(error) error) Option {
+	return func(o *opts) {
+		o.mapErrFn = mapFn
+	}
+}
+
+// SuccessWhen allows you to set a function to identify errors that should be
+// treated as success, for functions that report some benign outcomes as
+// errors. If it returns true for an error returned from the target function,
+// the run will end immediately and the retrier will return a nil error, along
+// with any value returned by that try. Defaults to nil.
+func SuccessWhen(successFn func(error) bool) Option {
+	return func(o *opts) {
+		o.successFn = successFn
+	}
+}
+
 // HaltFn allows you to set a function to use for identifying fatal errors.
 // It will be called for each error returned from the target function. If it
 // returns true, the retry loop will terminate immediately. Defaults to nil.
@@ -69,6 +409,17 @@ func HaltFn(haltFn func(error) bool) Option {
 	}
 }
 
+// HaltFnStatus works like [HaltFn], but haltFn is also passed the [Status] of
+// the try that failed, allowing for decisions such as halting after a number
+// of tries that is smaller than [MaxTries] for certain errors. If both HaltFn
+// and HaltFnStatus are set, HaltFn is consulted first, and the run will halt
+// if either returns true. Defaults to nil.
+func HaltFnStatus(haltFn func(error, Status) bool) Option {
+	return func(o *opts) {
+		o.haltStatusFn = haltFn
+	}
+}
+
 // HaltErrors is a shortcut to writing a [HaltFn] of the form
 //
 //	func(e error) bool {
@@ -99,21 +450,416 @@ func Each(eachFn func(Status)) Option {
 	}
 }
 
+// CoalesceEach quiets the functions set with [Each] and [EachCtx] while the
+// function keeps failing with the same error, treating two errors as the same
+// if they have the same message, or the later one [errors.Is] the earlier. They
+// are called for the first failure in each streak of the same error, and
+// then, if the streak went on, once more for its last failure, as soon as the
+// streak is known to have ended: with the next failure that differs, or when
+// the run ends. [Status].RepeatCount tells how many tries in a row had
+// failed with the error. Defaults to false, which calls them for every failure.
+func CoalesceEach(enabled bool) Option {
+	return func(o *opts) {
+		o.coalesceEach = enabled
+	}
+}
+
+// pendingEach is a failure suppressed by CoalesceEach, to be reported once its
+// streak ends.
+type pendingEach struct {
+	ctx    context.Context
+	status Status
+}
+
+// sameErr reports whether err is the same as prev, for CoalesceEach.
+func sameErr(err, prev error) bool {
+	if err == nil || prev == nil {
+		return false
+	}
+	return err.Error() == prev.Error() || errors.Is(err, prev)
+}
+
+// EachExcludesTerminal skips the functions set with [Each] and [EachCtx] for
+// the failed try that ends the run, whether by exhaustion, a halt or a context
+// error it returned, so that they only see tries that will be retried, and the
+// end of the run can be handled separately with the error it returns. The run
+// may still end during the delay after a try they were called for, if the
+// context is cancelled. If enabled, they are called after the halting options
+// have been checked, rather than before. Defaults to false, which calls them
+// for every failed try.
+func EachExcludesTerminal(enabled bool) Option {
+	return func(o *opts) {
+		o.eachSkipTerminal = enabled
+	}
+}
+
+// Explain appends a line to buf for each decision the run makes, explaining
+// why it carried on or ended, such as:
+//
+//	attempt 1/3 failed: timeout; continue; delay=1s
+//	attempt 2/3 failed: forbidden; stop: HaltFn
+//
+// The reason given for the end of the run names the option or condition that
+// ended it, which helps when several halting options interact. A successful
+// run ends with a line such as "attempt 2/3 succeeded". buf is only written to
+// by the run, so it must not be read until the run ends. Defaults to nil,
+// which records nothing.
+func Explain(buf *[]string) Option {
+	return func(o *opts) {
+		o.explainBuf = buf
+	}
+}
+
+// explainf records a decision for Explain, if set.
+func (o *opts) explainf(format string, args ...any) {
+	if o.explainBuf != nil {
+		*o.explainBuf = append(*o.explainBuf, fmt.Sprintf(format, args...))
+	}
+}
+
+// Trace writes a line describing each failed try to w, in the form:
+//
+//	attempt 2/10: error=<error> next=2s
+//
+// This is intended as a lightweight verbose mode for debugging, and works
+// independently of [Each]. Defaults to nil, which writes nothing.
+func Trace(w io.Writer) Option {
+	return func(o *opts) {
+		o.traceW = w
+	}
+}
+
+// LogNextTime makes [Status.LogValue] include the approximate time of the next
+// try as a "next_at" attribute, formatted using layout, such as
+// [time.RFC3339]. Defaults to "", which omits it.
+func LogNextTime(layout string) Option {
+	return func(o *opts) {
+		o.nextLayout = layout
+	}
+}
+
+// Summarize logs a single line to logger at level once the run ends, in place
+// of logging each try, for runs where the detail of each failure is not worth
+// the volume, such as:
+//
+//	level=WARN msg="retry run ended" outcome=ReasonExhausted attempts=10 elapsed=4m2s error="..."
+//
+// The outcome is the run's [Reason], and the error is only included if the run
+// failed. Any attributes identifying the operation can be added to logger with
+// [slog.Logger.With]. It can be used alongside [WithContextLogger] and the other
+// options that report each try. Defaults to nil, which logs nothing.
+func Summarize(logger *slog.Logger, level slog.Level) Option {
+	return func(o *opts) {
+		o.summaryLogger = logger
+		o.summaryLevel = level
+	}
+}
+
+// SlowAttemptThreshold sets a function to be called whenever a single call to
+// the function being retried takes longer than d, to flag slow dependencies
+// even when the calls eventually succeed. It is called directly after each slow
+// call, so it may be called several times in a run, or not at all. It is passed
+// the [Status] of the try, and how long the call took, which is also in
+// Status.LastDuration. Defaults to nil, which will take no action.
+func SlowAttemptThreshold(d time.Duration, slowFn func(Status, time.Duration)) Option {
+	return func(o *opts) {
+		o.slowThreshold = d
+		o.slowFn = slowFn
+	}
+}
+
+// WithContextLogger enriches a [*slog.Logger] carried in the context with the
+// [Status] of each try, so that anything the function logs with it is tagged
+// with the try it happened in, under a "retry" group. Before each try, extract
+// is called with the context passed to the retrier to get the logger, and store
+// is called to return a copy of the try's context holding the enriched logger,
+// so they should use the same context key as the rest of the application. If
+// extract returns nil, the context is left alone. Defaults to nil, which will
+// take no action.
+func WithContextLogger(
+	extract func(context.Context) *slog.Logger,
+	store func(context.Context, *slog.Logger) context.Context,
+) Option {
+	return func(o *opts) {
+		o.loggerExtract = extract
+		o.loggerStore = store
+	}
+}
+
+// OnSleep allows you to set a function to be called after each delay between
+// tries, whether it ran to completion or was interrupted. It is passed the
+// planned delay, as reported by [Status].NextDelay, and the time actually
+// spent waiting, which may be shorter if the context was cancelled or its
+// deadline was exceeded in the meantime. Defaults to nil, which will take no
+// action.
+func OnSleep(sleepFn func(planned, actual time.Duration)) Option {
+	return func(o *opts) {
+		o.sleepFn = sleepFn
+	}
+}
+
+// EachOrHalt works like [Each], but if eachFn returns an error, the run will be
+// halted with that error, as if it had been returned with [Halt]. It is called
+// after Each and [EachCtx], and before [HaltFn] and [HaltFnStatus] are
+// consulted, so it takes precedence over them, as well as over [MaxTries].
+// Defaults to nil.
+func EachOrHalt(eachFn func(Status) error) Option {
+	return func(o *opts) {
+		o.eachHaltFn = eachFn
+	}
+}
+
+// EachCtx works like [Each], but eachFn is also passed the context that was
+// passed to the failed try, so that it can carry out cancellable or traced
+// operations. The retry loop waits for eachFn to return, so any time spent in
+// it will delay the next try. If both Each and EachCtx are set, Each is called
+// first. Defaults to nil.
+func EachCtx(eachFn func(context.Context, Status)) Option {
+	return func(o *opts) {
+		o.eachCtxFn = eachFn
+	}
+}
+
+// CancelOnTerminal cancels the context passed to each try of the function
+// being retried as soon as the run ends, whether it was halted, exhausted or
+// cancelled, so that any work started by the tries that is still tied to their
+// contexts will be cleaned up promptly. The error the run ended with is used as
+// the cause, so it can be retrieved with [context.Cause]. Ordinarily, these
+// contexts are only cancelled if the context passed to the retrier is.
+// The contexts are cancelled when a successful run returns too, with
+// [context.Canceled] as the cause, so values returned by a successful run
+// must not depend on them. Defaults to false.
+func CancelOnTerminal(enabled bool) Option {
+	return func(o *opts) {
+		o.cancelOnTerminal = enabled
+	}
+}
+
 // CtxCause will enable or disable automatic context cancellation cause
 // extraction.
 // If enabled, redo will call [context.Cause] on all values of
 // [context.Canceled] and [context.DeadlineExceeded] to get the underlying
-// error, if it is set. Defaults to true, which enables this behavior
+// error, if it is set. This applies whether the run ends because the function
+// returned a context error, or because the context was done while waiting
+// between tries. If disabled, the run ends with the error returned by the
+// function or [context.Context.Err], respectively. Defaults to true, which
+// enables this behavior
 func CtxCause(enabled bool) Option {
 	return func(o *opts) {
 		o.noCause = !enabled
 	}
 }
 
+// Window restricts attempts to the times for which allowed returns true, such
+// as business hours. Before each attempt, if allowed returns false for the
+// current time, the run will wait until it returns true again rather than
+// attempting. The window is polled once every [WindowPollInterval], so an
+// attempt may start up to that long after the window reopens. Cancelling the
+// context while waiting will end the run. Defaults to nil, which allows
+// attempts at any time.
+func Window(allowed func(t time.Time) bool) Option {
+	return func(o *opts) {
+		o.windowFn = allowed
+	}
+}
+
+// Attempts will store the number of times the target function was called in n
+// when the run ends, however it ends. The pointer is only written after the
+// run has finished. Defaults to nil.
+func Attempts(n *int) Option {
+	return func(o *opts) {
+		o.attemptsPtr = n
+	}
+}
+
+// FinalAttempt sets a function to call once, as a last resort, after the run
+// has been exhausted by [MaxTries] or [MaxElapsed], before giving up, such as
+// the same operation with a longer timeout or a degraded mode:
+//
+//	redo.FinalAttempt(func(ctx context.Context) error {
+//	    ctx, cancel := context.WithTimeout(ctx, time.Minute)
+//	    defer cancel()
+//	    return fetch(ctx)
+//	})
+//
+// It is called straight away, without a delay, with the context of the last
+// try. If it returns nil, the run succeeds, and otherwise the run returns the
+// same exhausted error it would have without it, so its own error is lost.
+// It counts as a try in [Retrier.Stats] and [Attempts], but is not seen by
+// [Each] or the other callbacks, and it is not called for runs that are halted
+// or whose context is done. Since fn returns no value, if it succeeds, the
+// retriers that return one, such as [FnOutCtx], return the zero value with
+// [ErrNoFinalValue], so use [FinalAttemptOut] with those instead. Defaults to
+// nil, which gives up as soon as the run is exhausted.
+func FinalAttempt(fn func(context.Context) error) Option {
+	return func(o *opts) {
+		o.finalFn = fn
+	}
+}
+
+// FinalAttemptOut works like [FinalAttempt], for the retriers that return a
+// value, such as [FnOutCtx], which return the value from fn if it succeeds.
+// OUT must be the type they return, or they return [ErrNoFinalValue] as with
+// FinalAttempt. The retriers that return only an error ignore the value.
+func FinalAttemptOut[OUT any](fn func(context.Context) (OUT, error)) Option {
+	return func(o *opts) {
+		o.finalFn = func(ctx context.Context) error {
+			v, err := fn(ctx)
+			if err == nil && o.final != nil {
+				o.final.val, o.final.hasVal = v, true
+			}
+			return err
+		}
+	}
+}
+
+// finalResult records whether a run succeeded through its final attempt, and
+// the value from FinalAttemptOut, for the retriers that return a value.
+type finalResult struct {
+	ok     bool
+	val    any
+	hasVal bool
+}
+
+// withFinal returns options with one added that records in f whether the run
+// succeeds through its final attempt.
+func withFinal(options []Option, f *finalResult) []Option {
+	return append(options[:len(options):len(options)], func(o *opts) {
+		o.final = f
+	})
+}
+
+// finalValue returns the value for a retrier to return from a run that
+// succeeded through its final attempt.
+func finalValue[OUT any](f *finalResult) (OUT, error) {
+	var zero OUT
+	if !f.hasVal {
+		return zero, ErrNoFinalValue
+	}
+	if f.val == nil {
+		// a nil interface value, which cannot be asserted to OUT.
+		return zero, nil
+	}
+	v, ok := f.val.(OUT)
+	if !ok {
+		return zero, ErrNoFinalValue
+	}
+	return v, nil
+}
+
+// OnShutdown allows a run to wind down gracefully when the process is shutting
+// down, such as on SIGTERM, by closing shutdown. Unlike cancelling the run's
+// context, which may interrupt a try in progress, a try in progress is left to
+// finish, and its result stands if it succeeds. Once shutdown is closed, no
+// further try is started and the delay before the next one is cut short, and
+// the run halts with [ErrShuttingDown], wrapping the error from the last try,
+// if any. Waits for [Retrier.Pause], [Window] and [SkipIfOffline] are not cut
+// short. Defaults to nil, which never shuts down.
+func OnShutdown(shutdown <-chan struct{}) Option {
+	return func(o *opts) {
+		o.shutdown = shutdown
+	}
+}
+
+// shuttingDown reports whether the channel set with OnShutdown has been closed.
+func (o *opts) shuttingDown() bool {
+	select {
+	case <-o.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// LoadShed allows you to abandon retries while the process is overloaded, so
+// that retrying does not add to the load, using whatever signal suits, such as
+// the number of goroutines or the time spent in garbage collection:
+//
+//	redo.LoadShed(func() bool {
+//	    return runtime.NumGoroutine() > 10_000
+//	})
+//
+// After each failed try that would otherwise be retried, if shed returns true,
+// the run halts with [ErrLoadShed], wrapping the error from the try. It is not
+// consulted before the first try, or once the run has ended. Defaults to nil,
+// which never sheds.
+func LoadShed(shed func() bool) Option {
+	return func(o *opts) {
+		o.loadShedFn = shed
+	}
+}
+
+// SkipIfOffline allows you to supply a connectivity check, so that tries are
+// not wasted while there is no network. Before each try, if isOnline returns
+// false, the run will wait with backoff until it returns true again, without
+// counting the time spent offline against [MaxTries]. If the check has not
+// reported being online after timeout, the run will halt with [ErrOffline].
+// A timeout <= 0 will wait until the context is cancelled. Defaults to nil,
+// which never checks.
+func SkipIfOffline(isOnline func() bool, timeout time.Duration) Option {
+	return func(o *opts) {
+		o.onlineFn = isOnline
+		o.offlineTimeout = timeout
+	}
+}
+
+// AllowSubMillisecondDelays disables the [MinDelay] floor, allowing delays of
+// less than a millisecond for callers that really do want a tight retry loop.
+// Defaults to false.
+func AllowSubMillisecondDelays(allowed bool) Option {
+	return func(o *opts) {
+		o.allowSubMs = allowed
+	}
+}
+
+// Rand sets the random number generator used for jitter and any other
+// randomized settings, which is mostly useful to get reproducible runs in
+// tests. Since a *rand.Rand is not safe for concurrent use, it should not be
+// shared between concurrent runs. Defaults to nil, which uses the global
+// math/rand functions.
+func Rand(r *rand.Rand) Option {
+	return func(o *opts) {
+		o.rnd = r
+	}
+}
+
+// RunIDFunc sets the function used to generate the run ID at the start of each
+// run, which [AttemptID] combines with the try number. It should return IDs
+// that are unique enough to correlate logs, such as a UUID or a trace ID.
+// Defaults to nil, which uses 16 random hex digits.
+func RunIDFunc(newID func() string) Option {
+	return func(o *opts) {
+		o.runIDFn = newID
+	}
+}
+
 func applyDefaults(ro *opts) {
+	if ro.maxDelayRange[1] > 0 {
+		min, spread := ro.maxDelayRange[0], int64(ro.maxDelayRange[1]-ro.maxDelayRange[0])
+		if spread < math.MaxInt64 {
+			spread++
+		}
+		// never 0, which would fall back to the default below.
+		ro.maxDelay = max(min+time.Duration(ro.int63n(spread)), 1)
+	}
 	if ro.initialDelay <= 0 {
 		ro.initialDelay = DefaultInitialDelay
 	}
+	if ro.initialJitter > 0 {
+		spread := min(int64(ro.initialJitter), math.MaxInt64/2)
+		jitter := time.Duration(ro.int63n(spread*2+1) - spread)
+		if jitter > 0 && ro.initialDelay > math.MaxInt64-jitter {
+			jitter = 0
+		}
+		ro.initialDelay = max(ro.initialDelay+jitter, MinDelay)
+	}
+	if ro.maxDelay <= 0 && ro.maxDelayFactor >= 1 {
+		if f := float64(ro.initialDelay) * ro.maxDelayFactor; f < math.MaxInt64 {
+			ro.maxDelay = time.Duration(f)
+		} else {
+			ro.maxDelay = math.MaxInt64
+		}
+	}
 	if ro.maxDelay <= 0 {
 		if ro.initialDelay > DefaultMaxDelay {
 			ro.maxDelay = ro.initialDelay
@@ -124,14 +870,253 @@ func applyDefaults(ro *opts) {
 	if ro.maxTries == 0 {
 		ro.maxTries = DefaultMaxTries
 	}
+	if ro.maxElapsed > 0 && ro.maxElapsedJitter > 0 {
+		spread := min(int64(ro.maxElapsedJitter), math.MaxInt64/2)
+		jitter := time.Duration(ro.int63n(spread*2+1) - spread)
+		ro.maxElapsed = max(ro.maxElapsed+jitter, ro.maxElapsed/2)
+	}
+	if ro.clock == nil {
+		ro.clock = realClock{}
+	}
 }
 
 type opts struct {
-	initialDelay time.Duration
-	maxDelay     time.Duration
-	maxTries     int
-	firstFast    bool
-	eachFn       func(Status)
-	haltFn       func(error) bool
-	noCause      bool
+	initialDelay     time.Duration
+	maxDelay         time.Duration
+	maxTries         int
+	firstFast        bool
+	eachFn           func(Status)
+	eachCtxFn        func(context.Context, Status)
+	eachHaltFn       func(Status) error
+	sleepFn          func(planned, actual time.Duration)
+	traceW           io.Writer
+	attemptsPtr      *int
+	final            *finalResult
+	attemptsMade     int
+	retrier          *Retrier
+	progress         *Progress
+	quantum          time.Duration
+	allowSubMs       bool
+	noDelay          bool
+	startAttempt     int
+	cancelOnTerminal bool
+	haltFn           func(error) bool
+	haltStatusFn     func(error, Status) bool
+	validateFn       func() error
+	successFn        func(error) bool
+	mapErrFn         func(error) error
+	exhaustedFmt     func(error, Status) string
+	resetEqualFn     func(a, b error) bool
+	noCause          bool
+	rnd              *rand.Rand
+	windowFn         func(time.Time) bool
+	clock            clock
+	nextLayout       string
+	maxDelayRange    [2]time.Duration
+	maxDelayFactor   float64
+	maxElapsed       time.Duration
+	maxElapsedJitter time.Duration
+	autoTries        bool
+	requireBounded   bool
+	onlineFn         func() bool
+	offlineTimeout   time.Duration
+	runIDFn          func() string
+	eventFn          func(Event)
+	noStatusCtx      bool
+	untilCtxDone     bool
+	slowThreshold    time.Duration
+	slowFn           func(Status, time.Duration)
+	awsBackoff       bool
+	loggerExtract    func(context.Context) *slog.Logger
+	loggerStore      func(context.Context, *slog.Logger) context.Context
+	pool             *Pool
+	instantFirst     bool
+	maxDistinct      int
+	distinctKeyFn    func(error) string
+	taperToEnd       bool
+	shared           *SharedIterator
+	eachSkipTerminal bool
+	burst            int
+	expvars          *expvar.Map
+	budgetTarget     time.Duration
+	budgetMax        int
+	resumeElapsed    time.Duration
+	resumeErr        string
+	policyByErr      func(error) Policy
+	errPolicyTries   int
+	errPolicyDelays  map[[2]time.Duration]backoff.Iterator
+	initialJitter    time.Duration
+	loadShedFn       func() bool
+	finalFn          func(context.Context) error
+	depName          string
+	depLimiter       *DependencyLimiter
+	ctxValues        []ctxValue
+	summaryLogger    *slog.Logger
+	summaryLevel     slog.Level
+	coalesceEach     bool
+	shutdown         <-chan struct{}
+	explainBuf       *[]string
+	firstOutcome     func(error)
+	newIterator      func() backoff.Iterator
+}
+
+// slept is called after each delay between tries with the planned and actual
+// time spent waiting.
+func (o *opts) slept(planned, actual time.Duration) {
+	if o.sleepFn != nil {
+		o.sleepFn(planned, actual)
+	}
+	if o.retrier != nil {
+		o.retrier.slept.Add(int64(actual))
+	}
+}
+
+// taper scales down d, the delay after the given try, if TaperToEnd is set and
+// it is one of the last TaperTries delays of the run.
+func (o *opts) taper(d time.Duration, tryNumber int) time.Duration {
+	if !o.taperToEnd || o.maxTries <= 0 {
+		return d
+	}
+	// the number of tries that will be left after the next one.
+	remaining := max(o.maxTries-tryNumber-1, -1)
+	if remaining >= TaperTries {
+		return d
+	}
+	return time.Duration(float64(d) * float64(remaining+1) / float64(TaperTries+1))
+}
+
+// adjustDelay applies any configured transformations to a delay produced by the
+// backoff.
+func (o *opts) adjustDelay(d time.Duration) time.Duration {
+	if o.noDelay {
+		return 0
+	}
+	if o.quantum > 0 {
+		if r := d % o.quantum; r != 0 {
+			if d > math.MaxInt64-(o.quantum-r) {
+				d = math.MaxInt64
+			} else {
+				d += o.quantum - r
+			}
+		}
+		d = min(d, o.maxDelay)
+	}
+	if !o.allowSubMs && d > 0 && d < MinDelay {
+		d = min(MinDelay, o.maxDelay)
+	}
+	return d
+}
+
+// newRunID returns the ID for a new run.
+func (o *opts) newRunID() string {
+	if o.runIDFn != nil {
+		return o.runIDFn()
+	}
+	// the global source is used even if Rand is set, so that seeded runs share
+	// their jitter but not their IDs.
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// newBackoff returns a new iterator of the configured kind.
+func (o *opts) newBackoff(options ...backoff.Option) backoff.Iterator {
+	var delays backoff.Iterator
+	if o.newIterator != nil {
+		delays = o.newIterator()
+		if o.firstFast {
+			delays = burst(delays, 1)
+		}
+	} else if o.awsBackoff {
+		delays = backoff.AWS(o.initialDelay, o.maxDelay, options...)
+		if o.firstFast {
+			delays = burst(delays, 1)
+		}
+	} else {
+		delays = backoff.New(o.initialDelay, o.maxDelay, o.firstFast, options...)
+	}
+	n := o.burst
+	if o.instantFirst {
+		n = max(n, 1)
+	}
+	if o.firstFast {
+		// the first retry is already immediate, and counts as part of the
+		// burst.
+		n--
+	}
+	return burst(delays, n)
+}
+
+// burst returns delays with n extra delays of 0 at the start.
+func burst(delays backoff.Iterator, n int) backoff.Iterator {
+	if n <= 0 {
+		return delays
+	}
+	return func() time.Duration {
+		if n > 0 {
+			n--
+			return 0
+		}
+		return delays()
+	}
+}
+
+// budgetTries returns the number of tries, including the first, that fit in
+// remaining if each takes latency, given the next delay, as estimated for
+// BudgetFromFirstLatency.
+func (o *opts) budgetTries(remaining, latency, next time.Duration) int {
+	delays := o.newBackoff(backoff.Median())
+	delays() // the step already taken for next
+	tries := 1
+	for cost := next + latency; cost <= remaining; cost += delays() + latency {
+		tries++
+		if cost < 0 || tries == math.MaxInt {
+			break
+		}
+	}
+	return tries
+}
+
+// tooManyDistinct adds err to the set of distinct errors seen, and returns true
+// if the set has grown larger than MaxDistinctErrors allows.
+func (o *opts) tooManyDistinct(seen *map[string]struct{}, err error) bool {
+	if *seen == nil {
+		*seen = make(map[string]struct{})
+	}
+	key := err.Error()
+	if o.distinctKeyFn != nil {
+		key = o.distinctKeyFn(err)
+	}
+	(*seen)[key] = struct{}{}
+	return len(*seen) > o.maxDistinct
+}
+
+// ctxErr returns the error to end the run with when ctx is done, which is its
+// cause unless CtxCause is disabled.
+func (o *opts) ctxErr(ctx context.Context) error {
+	if o.noCause {
+		return ctx.Err()
+	}
+	return context.Cause(ctx)
+}
+
+func (o *opts) int63n(n int64) int64 {
+	if o.rnd == nil {
+		return rand.Int63n(n)
+	}
+	return o.rnd.Int63n(n)
+}
+
+// summarize logs the end of the run for Summarize, if set.
+func (o *opts) summarize(ctx context.Context, err error, elapsed time.Duration) {
+	if o.summaryLogger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Any("outcome", ReasonOf(err)),
+		slog.Int("attempts", o.attemptsMade),
+		slog.Duration("elapsed", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	o.summaryLogger.LogAttrs(ctx, o.summaryLevel, "retry run ended", attrs...)
 }
@@ -0,0 +1,1199 @@
+package redo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"andy.dev/redo/backoff"
+)
+
+func TestMaxDelayRange(t *testing.T) {
+	const (
+		min = 2 * time.Millisecond
+		max = 4 * time.Millisecond
+	)
+	rnd := rand.New(rand.NewSource(1))
+	seen := map[time.Duration]bool{}
+	for range 200 {
+		o := &opts{}
+		MaxDelayRange(min, max)(o)
+		Rand(rnd)(o)
+		applyDefaults(o)
+		if o.maxDelay < min || o.maxDelay > max {
+			t.Fatalf("ceiling %v outside of [%v, %v]", o.maxDelay, min, max)
+		}
+		seen[o.maxDelay] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected ceiling to vary between runs, got %v", seen)
+	}
+}
+
+func TestInitialDelayJitter(t *testing.T) {
+	const (
+		initial = 100 * time.Millisecond
+		spread  = 50 * time.Millisecond
+	)
+	rnd := rand.New(rand.NewSource(1))
+	var below, above int
+	for range 1000 {
+		o := &opts{}
+		InitialDelay(initial)(o)
+		InitialDelayJitter(spread)(o)
+		Rand(rnd)(o)
+		applyDefaults(o)
+		if o.initialDelay < initial-spread || o.initialDelay > initial+spread {
+			t.Fatalf("initial delay %v outside of %v±%v", o.initialDelay, initial, spread)
+		}
+		switch {
+		case o.initialDelay < initial-spread/2:
+			below++
+		case o.initialDelay > initial+spread/2:
+			above++
+		}
+	}
+	// each outer quarter of the range should hold about a quarter of the runs.
+	for _, n := range []int{below, above} {
+		if n < 200 || n > 300 {
+			t.Fatalf("got %d and %d runs in the outer quarters, want about 250", below, above)
+		}
+	}
+
+	o := &opts{}
+	InitialDelay(time.Millisecond)(o)
+	InitialDelayJitter(time.Hour)(o)
+	for range 100 {
+		applyDefaults(o)
+		if o.initialDelay < MinDelay {
+			t.Fatalf("initial delay %v below MinDelay", o.initialDelay)
+		}
+		o.initialDelay = time.Millisecond
+	}
+}
+
+func TestMaxDelayRangeRespected(t *testing.T) {
+	ranges := [][2]time.Duration{
+		{1 * time.Millisecond, 3 * time.Millisecond},
+		{0, 2 * time.Millisecond},
+	}
+	for _, r := range ranges {
+		for seed := range int64(20) {
+			// the ceiling is the first value drawn from the source.
+			o := &opts{}
+			MaxDelayRange(r[0], r[1])(o)
+			Rand(rand.New(rand.NewSource(seed)))(o)
+			applyDefaults(o)
+			ceiling := o.maxDelay
+			if ceiling < max(r[0], 1) || ceiling > r[1] {
+				t.Fatalf("ceiling %v outside of [%v, %v]", ceiling, r[0], r[1])
+			}
+
+			var delays []time.Duration
+			_ = FnCtx(context.Background(), func(context.Context) error {
+				return errors.New("fail")
+			},
+				InitialDelay(time.Millisecond),
+				MaxDelayRange(r[0], r[1]),
+				MaxTries(8),
+				Rand(rand.New(rand.NewSource(seed))),
+				Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+			)
+			for _, d := range delays {
+				if d > ceiling {
+					t.Fatalf("delay %v exceeds per-run ceiling %v: %v", d, ceiling, delays)
+				}
+			}
+		}
+	}
+}
+
+func TestMaxDelayRangeInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for min > max")
+		}
+	}()
+	MaxDelayRange(2*time.Second, time.Second)
+}
+
+func TestMaxDelayFactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		factor float64
+		want   time.Duration
+	}{
+		{"one", []Option{InitialDelay(time.Second)}, 1, time.Second},
+		{"fractional", []Option{InitialDelay(time.Second)}, 2.5, 2500 * time.Millisecond},
+		{"default initial", nil, 10, 10 * DefaultInitialDelay},
+		{"overflow", []Option{InitialDelay(time.Hour)}, 1e300, math.MaxInt64},
+		{"MaxDelay wins", []Option{InitialDelay(time.Second), MaxDelay(time.Minute)}, 10, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &opts{}
+			for _, opt := range append(tt.opts, MaxDelayFactor(tt.factor)) {
+				opt(o)
+			}
+			applyDefaults(o)
+			if o.maxDelay != tt.want {
+				t.Errorf("got max delay %v, want %v", o.maxDelay, tt.want)
+			}
+		})
+	}
+
+	var delays []time.Duration
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxDelayFactor(3),
+		MaxTries(8),
+		Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+	)
+	for _, d := range delays {
+		if d > 3*time.Millisecond {
+			t.Fatalf("delay %v exceeds 3 * InitialDelay: %v", d, delays)
+		}
+	}
+}
+
+func TestMaxDelayFactorInvalid(t *testing.T) {
+	for _, n := range []float64{0.5, 0, -1, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for factor %v", n)
+				}
+			}()
+			MaxDelayFactor(n)
+		}()
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		eachN int
+	)
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(3),
+		Trace(&buf),
+		Each(func(Status) { eachN++ }),
+	)
+	if eachN != 3 {
+		t.Errorf("Each called %d times, want 3", eachN)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		re := regexp.MustCompile(fmt.Sprintf(`^attempt %d/3: error=fail next=\S+$`, i+1))
+		if !re.MatchString(line) {
+			t.Errorf("line %d: %q does not match %s", i, line, re)
+		}
+	}
+
+	// long delays are shortened for display, but not lost.
+	for _, tt := range []struct {
+		delay time.Duration
+		want  string
+	}{
+		{150 * time.Second, "next=2m0s"},
+		{90 * time.Minute, "next=1h30m0s"},
+	} {
+		buf.Reset()
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, MaxTries(2), fixedDelay(tt.delay), withClock(newFakeClock(time.Time{})), Trace(&buf))
+		if line := strings.SplitN(buf.String(), "\n", 2)[0]; line != "attempt 1/2: error=fail "+tt.want {
+			t.Errorf("got %q for a delay of %v, want %s", line, tt.delay, tt.want)
+		}
+	}
+}
+
+// fixedDelay makes every delay of a run d.
+func fixedDelay(d time.Duration) Option {
+	return Backoff(func() backoff.Iterator {
+		return func() time.Duration { return d }
+	})
+}
+
+func TestResetBackoffOnErrorChange(t *testing.T) {
+	var (
+		errThrottled = errors.New("throttled")
+		errTransient = errors.New("transient")
+	)
+	errs := []error{errThrottled, errThrottled, errThrottled, errTransient, errTransient}
+	var delays []time.Duration
+	try := 0
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		err := errs[try]
+		try++
+		return err
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(len(errs)),
+		Rand(rand.New(rand.NewSource(1))),
+		ResetBackoffOnErrorChange(func(a, b error) bool { return errors.Is(a, b) }),
+		Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+	)
+
+	// replay the same random stream: three delays on the original curve, one
+	// discarded when the error changes, then two from the start of a new curve.
+	rnd := rand.New(rand.NewSource(1))
+	ref := backoff.New(time.Millisecond, DefaultMaxDelay, false, backoff.WithRand(rnd))
+	want := []time.Duration{ref(), ref(), ref()}
+	ref()
+	ref = backoff.New(time.Millisecond, DefaultMaxDelay, false, backoff.WithRand(rnd))
+	want = append(want, ref(), ref())
+	if fmt.Sprint(delays) != fmt.Sprint(want) {
+		t.Fatalf("got delays %v, want %v", delays, want)
+	}
+}
+
+func TestHaltFnStatus(t *testing.T) {
+	errAuth := errors.New("unauthorized")
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errAuth
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(10),
+		HaltFnStatus(func(err error, s Status) bool {
+			return errors.Is(err, errAuth) && s.TryNumber >= 3
+		}),
+	)
+	if !Halted(err) {
+		t.Fatalf("expected halted error, got %v", err)
+	}
+	if tries != 3 {
+		t.Fatalf("got %d tries, want 3", tries)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	var n int
+	try := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		try++
+		if try < 3 {
+			return errors.New("fail")
+		}
+		return nil
+	}, InitialDelay(time.Millisecond), Attempts(&n))
+	if err != nil || n != 3 {
+		t.Fatalf("got %d attempts (%v), want 3", n, err)
+	}
+
+	err = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxTries(4), Attempts(&n))
+	if !Exhausted(err) || n != 4 {
+		t.Fatalf("got %d attempts (%v), want 4", n, err)
+	}
+
+	err = FnCtx(context.Background(), func(context.Context) error {
+		return Halt(errors.New("fatal"))
+	}, Attempts(&n))
+	if !Halted(err) || n != 1 {
+		t.Fatalf("got %d attempts (%v), want 1", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = FnCtx(ctx, func(context.Context) error {
+		cancel()
+		return errors.New("fail")
+	}, Attempts(&n))
+	if !errors.Is(err, context.Canceled) || n != 1 {
+		t.Fatalf("got %d attempts (%v), want 1", n, err)
+	}
+}
+
+func TestQuantizeDelay(t *testing.T) {
+	tests := []struct {
+		quantum  time.Duration
+		maxDelay time.Duration
+		in, want time.Duration
+	}{
+		{5 * time.Second, time.Hour, 0, 0},
+		{5 * time.Second, time.Hour, 1, 5 * time.Second},
+		{5 * time.Second, time.Hour, 5 * time.Second, 5 * time.Second},
+		{5 * time.Second, time.Hour, 7 * time.Second, 10 * time.Second},
+		{time.Minute, time.Hour, 61 * time.Second, 2 * time.Minute},
+		{time.Minute, 90 * time.Second, 61 * time.Second, 90 * time.Second},
+		{time.Hour, math.MaxInt64, math.MaxInt64 - 1, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		o := &opts{maxDelay: tt.maxDelay}
+		QuantizeDelay(tt.quantum)(o)
+		if got := o.adjustDelay(tt.in); got != tt.want {
+			t.Errorf("quantum %v, max %v: adjustDelay(%v) = %v, want %v", tt.quantum, tt.maxDelay, tt.in, got, tt.want)
+		}
+	}
+
+	var delays []time.Duration
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		QuantizeDelay(3*time.Millisecond),
+		MaxTries(4),
+		Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+	)
+	for _, d := range delays {
+		if d%(3*time.Millisecond) != 0 {
+			t.Errorf("delay %v is not a multiple of the quantum", d)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errInvalid := errors.New("invalid input")
+	var n int
+	err := FnCtx(context.Background(), func(context.Context) error {
+		t.Fatal("attempted despite failed validation")
+		return nil
+	}, Validate(func() error { return errInvalid }), Attempts(&n))
+	if !Halted(err) || !errors.Is(err, errInvalid) {
+		t.Fatalf("expected halted %v, got %v", errInvalid, err)
+	}
+	if n != 0 {
+		t.Fatalf("got %d attempts, want 0", n)
+	}
+
+	validations := 0
+	tries := 0
+	err = FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		if tries < 3 {
+			return errors.New("fail")
+		}
+		return nil
+	}, InitialDelay(time.Millisecond), Validate(func() error {
+		validations++
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validations != 1 {
+		t.Fatalf("validated %d times, want 1", validations)
+	}
+}
+
+func TestSuccessWhen(t *testing.T) {
+	errAlreadyExists := errors.New("already exists")
+	tries := 0
+	val, err := FnOutCtx(context.Background(), func(context.Context) (string, error) {
+		tries++
+		if tries < 2 {
+			return "", errors.New("fail")
+		}
+		return "existing", errAlreadyExists
+	},
+		InitialDelay(time.Millisecond),
+		SuccessWhen(func(err error) bool { return errors.Is(err, errAlreadyExists) }),
+	)
+	if err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+	if val != "existing" || tries != 2 {
+		t.Fatalf("got %q after %d tries, want %q after 2", val, tries, "existing")
+	}
+}
+
+func TestEachCtx(t *testing.T) {
+	type traceKey struct{}
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-id")
+	calls := 0
+	_ = FnCtx(ctx, func(context.Context) error {
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxTries(2), EachCtx(func(ctx context.Context, s Status) {
+		calls++
+		if got := GetStatus(ctx).TryNumber; got != s.TryNumber {
+			t.Errorf("context has try %d, want %d", got, s.TryNumber)
+		}
+		if ctx.Value(traceKey{}) != "trace-id" {
+			t.Error("context is missing the parent's values")
+		}
+	}))
+	if calls != 2 {
+		t.Fatalf("got %d calls, want 2", calls)
+	}
+}
+
+func TestMaxElapsed(t *testing.T) {
+	const budget = 30 * time.Millisecond
+	start := time.Now()
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errors.New("fail")
+	}, InitialDelay(5*time.Millisecond), MaxDelay(5*time.Millisecond), MaxTries(-1), MaxElapsed(budget))
+	if !Exhausted(err) {
+		t.Fatalf("expected exhausted error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > budget+20*time.Millisecond {
+		t.Fatalf("run took %v, budget was %v", elapsed, budget)
+	}
+	if tries < 2 {
+		t.Fatalf("got %d tries, want several", tries)
+	}
+}
+
+func TestMaxElapsedJitter(t *testing.T) {
+	const (
+		budget = time.Minute
+		spread = 10 * time.Second
+	)
+	rnd := rand.New(rand.NewSource(1))
+	var lo, hi time.Duration = budget, budget
+	for range 1000 {
+		o := &opts{}
+		MaxElapsed(budget)(o)
+		MaxElapsedJitter(spread)(o)
+		Rand(rnd)(o)
+		applyDefaults(o)
+		if o.maxElapsed < budget-spread || o.maxElapsed > budget+spread {
+			t.Fatalf("budget %v outside of %v ± %v", o.maxElapsed, budget, spread)
+		}
+		lo, hi = min(lo, o.maxElapsed), max(hi, o.maxElapsed)
+	}
+	// with 1000 samples, both ends of the range should be well explored.
+	if lo > budget-spread/2 || hi < budget+spread/2 {
+		t.Fatalf("budgets only varied within [%v, %v]", lo, hi)
+	}
+
+	o := &opts{}
+	MaxElapsed(budget)(o)
+	MaxElapsedJitter(time.Hour)(o)
+	applyDefaults(o)
+	if o.maxElapsed < budget/2 {
+		t.Fatalf("budget %v below floor of %v", o.maxElapsed, budget/2)
+	}
+}
+
+func TestMapError(t *testing.T) {
+	errFail := errors.New("fail")
+	var seen []string
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errFail
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(2),
+		MapError(func(err error) error { return fmt.Errorf("request 42: %w", err) }),
+		Each(func(s Status) { seen = append(seen, s.Err.Error()) }),
+	)
+	if !Exhausted(err) || !errors.Is(err, errFail) || err.Error() != "request 42: fail" {
+		t.Fatalf("got %v, want exhausted, mapped error", err)
+	}
+	for _, s := range seen {
+		if s != "request 42: fail" {
+			t.Errorf("Each saw %q, want the mapped error", s)
+		}
+	}
+
+	tries := 0
+	err = FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errFail
+	}, MapError(func(error) error { return nil }))
+	if err != nil || tries != 1 {
+		t.Fatalf("got %v after %d tries, want success after 1", err, tries)
+	}
+}
+
+func TestAutoTriesFromDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var n int
+	err := FnCtx(ctx, func(context.Context) error {
+		return errors.New("fail")
+	}, InitialDelay(10*time.Millisecond), AutoTriesFromDeadline(true), Attempts(&n))
+	if !Exhausted(err) {
+		t.Fatalf("expected exhausted error, got %v", err)
+	}
+	// the median delays are roughly 12.6ms, 15.3ms, then 28.5ms, so only two
+	// fit in 50ms.
+	if n != 3 {
+		t.Fatalf("got %d tries, want 3", n)
+	}
+
+	o := &opts{initialDelay: time.Second, maxDelay: DefaultMaxDelay}
+	if tries := estimateTries(time.Hour, o); tries <= DefaultMaxTries {
+		t.Fatalf("estimated %d tries for an hour, want more than the default", tries)
+	}
+}
+
+func TestRequireBoundedRun(t *testing.T) {
+	fail := func(context.Context) error { return errors.New("fail") }
+	called := false
+	made := -1
+	var buf bytes.Buffer
+	err := FnCtx(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	}, MaxTries(-1), RequireBoundedRun(true), Attempts(&made), Summarize(slog.New(slog.NewTextHandler(&buf, nil)), slog.LevelInfo))
+	if !errors.Is(err, ErrUnbounded) || called {
+		t.Fatalf("got %v (called: %v), want %v without calling", err, called, ErrUnbounded)
+	}
+	// the run still ends as usual, having made no tries.
+	if made != 0 || !strings.Contains(buf.String(), "attempts=0") {
+		t.Fatalf("got %d attempts and summary %q, want 0 attempts reported", made, buf.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	bounded := []struct {
+		name string
+		ctx  context.Context
+		opts []Option
+	}{
+		{"deadline", ctx, nil},
+		{"max elapsed", context.Background(), []Option{MaxElapsed(10 * time.Millisecond)}},
+	}
+	for _, b := range bounded {
+		opts := append([]Option{InitialDelay(time.Millisecond), MaxTries(-1), RequireBoundedRun(true)}, b.opts...)
+		if err := FnCtx(b.ctx, fail, opts...); errors.Is(err, ErrUnbounded) {
+			t.Errorf("%s: got %v for a bounded run", b.name, err)
+		}
+	}
+}
+
+func TestEachOrHalt(t *testing.T) {
+	errEnough := errors.New("enough")
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), EachOrHalt(func(s Status) error {
+		if s.TryNumber == 2 {
+			return errEnough
+		}
+		return nil
+	}))
+	if !Halted(err) || !errors.Is(err, errEnough) {
+		t.Fatalf("got %v, want halted %v", err, errEnough)
+	}
+	if tries != 2 {
+		t.Fatalf("got %d tries, want 2", tries)
+	}
+}
+
+func TestMinDelay(t *testing.T) {
+	const tries = 20
+	run := func(options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, append([]Option{
+			InitialDelay(time.Nanosecond),
+			MaxTries(tries),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	// a curve this small can truncate to a delay of 0, which is not floored, so
+	// only the non-zero delays are checked.
+	for _, d := range run() {
+		if d > 0 && d < MinDelay {
+			t.Errorf("got delay %v with the floor, want at least %v", d, MinDelay)
+		}
+	}
+	if delays := run(AllowSubMillisecondDelays(true)); slices.Max(delays) >= MinDelay {
+		t.Errorf("got delays %v without the floor, want all less than %v", delays, MinDelay)
+	}
+}
+
+func BenchmarkTinyDelay(b *testing.B) {
+	fail := func(context.Context) error { return errors.New("fail") }
+	for _, allow := range []bool{false, true} {
+		b.Run(fmt.Sprintf("AllowSubMillisecondDelays=%v", allow), func(b *testing.B) {
+			for range b.N {
+				_ = FnCtx(context.Background(), fail,
+					InitialDelay(time.Nanosecond),
+					MaxTries(10),
+					AllowSubMillisecondDelays(allow),
+				)
+			}
+		})
+	}
+}
+
+func TestNoDelay(t *testing.T) {
+	const tries = 1000
+	start := time.Now()
+	var delays []time.Duration
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("conflict")
+	}, NoDelay(), MaxTries(tries), Each(func(s Status) { delays = append(delays, s.NextDelay) }))
+	if !Exhausted(err) || len(delays) != tries {
+		t.Fatalf("got %v after %d tries, want exhausted after %d", err, len(delays), tries)
+	}
+	for _, d := range delays {
+		if d != 0 {
+			t.Fatalf("got delay %v, want 0", d)
+		}
+	}
+	// the default curve would take around an hour for this many tries.
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %v for %d immediate tries", elapsed, tries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	err = FnCtx(ctx, func(context.Context) error {
+		n++
+		if n == 3 {
+			cancel()
+		}
+		return errors.New("conflict")
+	}, NoDelay(), MaxTries(-1))
+	if !errors.Is(err, context.Canceled) || n != 3 {
+		t.Fatalf("got %v after %d tries, want cancellation after 3", err, n)
+	}
+}
+
+func TestStartAttempt(t *testing.T) {
+	var tries []int
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		tries = append(tries, GetStatus(ctx).TryNumber)
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxDelay(2*time.Millisecond), MaxTries(6), StartAttempt(4))
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if fmt.Sprint(tries) != "[4 5 6]" {
+		t.Fatalf("got tries %v, want [4 5 6]", tries)
+	}
+
+	tries = nil
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		tries = append(tries, GetStatus(ctx).TryNumber)
+		return errors.New("fail")
+	}, MaxTries(3), StartAttempt(5))
+	if fmt.Sprint(tries) != "[5]" {
+		t.Fatalf("got tries %v, want [5]", tries)
+	}
+
+	// the backoff resumes on the same curve, rather than starting over.
+	var first time.Duration
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		return Halt(errors.New("fail"))
+	},
+		InitialDelay(time.Millisecond),
+		StartAttempt(8),
+		Rand(rand.New(rand.NewSource(1))),
+		Each(func(s Status) { first = s.NextDelay }),
+	)
+	ref := backoff.New(time.Millisecond, DefaultMaxDelay, false, backoff.WithRand(rand.New(rand.NewSource(1))))
+	for range 7 {
+		ref()
+	}
+	if want := ref(); first != want {
+		t.Fatalf("got delay %v for try 8, want %v", first, want)
+	}
+}
+
+func TestCancelOnTerminal(t *testing.T) {
+	errFatal := errors.New("fatal")
+	var tryCtxs []context.Context
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		tryCtxs = append(tryCtxs, ctx)
+		if len(tryCtxs) < 3 {
+			return errors.New("fail")
+		}
+		return Halt(errFatal)
+	}, NoDelay(), CancelOnTerminal(true))
+	if !Halted(err) {
+		t.Fatalf("got %v, want halted", err)
+	}
+	// the context of every try is cancelled, not only that of the last.
+	for i, tryCtx := range tryCtxs {
+		select {
+		case <-tryCtx.Done():
+		default:
+			t.Fatalf("context of try %d was not cancelled when the run halted", i+1)
+		}
+		if cause := context.Cause(tryCtx); !errors.Is(cause, errFatal) {
+			t.Fatalf("got cause %v for try %d, want %v", cause, i+1, errFatal)
+		}
+	}
+
+	// a successful run releases its context from a parent that lives on, which
+	// only happens once the context is cancelled.
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var tryCtx context.Context
+	_ = FnCtx(parent, func(ctx context.Context) error {
+		tryCtx = ctx
+		return nil
+	}, CancelOnTerminal(true))
+	if !errors.Is(context.Cause(tryCtx), context.Canceled) || parent.Err() != nil {
+		t.Fatal("try context was not released after a successful run")
+	}
+
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		tryCtx = ctx
+		return Halt(errFatal)
+	})
+	if tryCtx.Err() != nil {
+		t.Fatal("try context was cancelled without CancelOnTerminal")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const schedule = "100ms\n\n 1.5s \n2m\n"
+	newIterator := func() backoff.Iterator {
+		it, err := backoff.FromReader(strings.NewReader(schedule))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return it
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := newFakeClock(start)
+	var at []string
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		at = append(at, clk.Now().Sub(start).String())
+		return errors.New("fail")
+	}, MaxTries(5), Backoff(newIterator), withClock(clk))
+	// the recorded delays are replayed, and the last repeated.
+	if want := "[0s 100ms 1.6s 2m1.6s 4m1.6s]"; fmt.Sprint(at) != want {
+		t.Fatalf("got tries at %v, want %v", at, want)
+	}
+
+	// FirstFast still makes the first retry immediate.
+	var delays []time.Duration
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	}, MaxTries(3), FirstFast(true), Backoff(newIterator), withClock(newFakeClock(start)), Each(func(s Status) {
+		delays = append(delays, s.NextDelay)
+	}))
+	if want := "[0s 100ms 1.5s]"; fmt.Sprint(delays) != want {
+		t.Fatalf("got delays %v, want %v", delays, want)
+	}
+}
+
+func TestAWSBackoff(t *testing.T) {
+	const (
+		initial  = time.Millisecond
+		maxDelay = 4 * time.Millisecond
+	)
+	run := func(options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, append([]Option{
+			AWSBackoff(),
+			InitialDelay(initial),
+			MaxDelay(maxDelay),
+			MaxTries(8),
+			Rand(rand.New(rand.NewSource(1))),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	for _, d := range run() {
+		if d < initial || d > maxDelay {
+			t.Fatalf("delay %v outside of [%v, %v]", d, initial, maxDelay)
+		}
+	}
+	if delays := run(FirstFast(true)); delays[0] != 0 || delays[1] < initial {
+		t.Fatalf("got delays %v, want only the first retry to be immediate", delays)
+	}
+}
+
+func TestInstantFirstRetry(t *testing.T) {
+	run := func(options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, append([]Option{
+			InitialDelay(time.Millisecond),
+			MaxTries(5),
+			Rand(rand.New(rand.NewSource(1))),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	normal := run()
+	instant := run(InstantFirstRetry(true))
+	// [try 1] 0 [try 2] backoff from the start of the curve [try 3]...
+	if instant[0] != 0 || !slices.Equal(instant[1:], normal[:len(normal)-1]) {
+		t.Fatalf("got delays %v, want 0 followed by %v", instant, normal[:len(normal)-1])
+	}
+	// FirstFast skips the first step of the curve instead.
+	if fast := run(FirstFast(true)); fast[0] != 0 || slices.Equal(fast[1:], instant[1:]) {
+		t.Fatalf("got the same delays %v for FirstFast and InstantFirstRetry", fast)
+	}
+}
+
+func TestMaxDistinctErrors(t *testing.T) {
+	errs := []error{
+		errors.New("a"), errors.New("b"), errors.New("a"), errors.New("c"), errors.New("d"),
+	}
+	run := func(options ...Option) (error, int) {
+		tries := 0
+		err := FnCtx(context.Background(), func(context.Context) error {
+			tries++
+			return errs[tries-1]
+		}, append([]Option{NoDelay(), MaxTries(len(errs))}, options...)...)
+		return err, tries
+	}
+	// "a" repeating does not count again, so the third distinct error is "c".
+	if err, tries := run(MaxDistinctErrors(2, nil)); !Halted(err) || err.Error() != "c" || tries != 4 {
+		t.Fatalf("got %v after %d tries, want halted on c after 4", err, tries)
+	}
+	if err, tries := run(MaxDistinctErrors(4, nil)); !Exhausted(err) || tries != len(errs) {
+		t.Fatalf("got %v after %d tries, want exhausted", err, tries)
+	}
+	// every error has the same type, so they are never distinct by type.
+	byType := func(err error) string { return fmt.Sprintf("%T", err) }
+	if err, _ := run(MaxDistinctErrors(1, byType)); !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+}
+
+func TestTaperToEnd(t *testing.T) {
+	const tries = 6
+	run := func(options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, append([]Option{
+			InitialDelay(time.Millisecond),
+			MaxTries(tries),
+			AllowSubMillisecondDelays(true),
+			Rand(rand.New(rand.NewSource(1))),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	normal := run()
+	tapered := run(TaperToEnd(true))
+	// the delays before tries 1-3 are untouched, then scaled by 3/4, 2/4, 1/4,
+	// and the unused delay after the final try is 0.
+	scale := []float64{1, 1, 3.0 / 4, 2.0 / 4, 1.0 / 4, 0}
+	for i := range tries {
+		want := time.Duration(float64(normal[i]) * scale[i])
+		if tapered[i] != want {
+			t.Errorf("delay after try %d: got %v, want %v", i+1, tapered[i], want)
+		}
+	}
+	if tapered[tries-2] >= normal[tries-2] {
+		t.Errorf("got final delay %v, want less than %v", tapered[tries-2], normal[tries-2])
+	}
+
+	// no effect without a limit on tries.
+	var delays []time.Duration
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		if GetStatus(ctx).TryNumber == 3 {
+			return Halt(errors.New("done"))
+		}
+		return errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxTries(-1), TaperToEnd(true), Each(func(s Status) {
+		delays = append(delays, s.NextDelay)
+	}))
+	for _, d := range delays {
+		if d == 0 {
+			t.Fatalf("got tapered delays %v for an unlimited run", delays)
+		}
+	}
+}
+
+func TestEachExcludesTerminal(t *testing.T) {
+	run := func(fn func(context.Context) error, options ...Option) []int {
+		var tries []int
+		_ = FnCtx(context.Background(), fn, append([]Option{
+			NoDelay(),
+			MaxTries(3),
+			Each(func(s Status) { tries = append(tries, s.TryNumber) }),
+		}, options...)...)
+		return tries
+	}
+	fail := func(context.Context) error { return errors.New("fail") }
+	halt := func(ctx context.Context) error {
+		if GetStatus(ctx).TryNumber == 2 {
+			return Halt(errors.New("fatal"))
+		}
+		return errors.New("fail")
+	}
+	tests := []struct {
+		name     string
+		fn       func(context.Context) error
+		excludes bool
+		want     []int
+	}{
+		{"exhausted", fail, false, []int{1, 2, 3}},
+		{"exhausted excluding terminal", fail, true, []int{1, 2}},
+		{"halted", halt, false, []int{1, 2}},
+		{"halted excluding terminal", halt, true, []int{1}},
+	}
+	for _, tt := range tests {
+		if got := run(tt.fn, EachExcludesTerminal(tt.excludes)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got Each calls for tries %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBurst(t *testing.T) {
+	const burst = 3
+	run := func(options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return errors.New("fail")
+		}, append([]Option{
+			InitialDelay(time.Millisecond),
+			MaxTries(7),
+			Rand(rand.New(rand.NewSource(1))),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	normal := run()
+	got := run(Burst(burst))
+	if len(got) != 7 {
+		t.Fatalf("got %d tries, want the burst to count towards MaxTries", len(got))
+	}
+	if !slices.Equal(got[:burst], make([]time.Duration, burst)) {
+		t.Fatalf("got delays %v, want the first %d to be 0", got, burst)
+	}
+	if !slices.Equal(got[burst:], normal[:len(normal)-burst]) {
+		t.Fatalf("got delays %v after the burst, want %v", got[burst:], normal[:len(normal)-burst])
+	}
+	if both := run(Burst(2), InstantFirstRetry(true)); both[1] != 0 || both[2] == 0 {
+		t.Fatalf("got delays %v, want the larger burst of 2", both)
+	}
+	// FirstFast's immediate retry is part of the burst, not added to it.
+	if fast := run(Burst(burst), FirstFast(true)); !slices.Equal(fast[:burst], make([]time.Duration, burst)) || fast[burst] == 0 {
+		t.Fatalf("got delays %v, want %d immediate retries", fast, burst)
+	}
+	if fast := run(InstantFirstRetry(true), FirstFast(true)); fast[0] != 0 || fast[1] == 0 {
+		t.Fatalf("got delays %v, want 1 immediate retry", fast)
+	}
+}
+
+func TestContextValueFunc(t *testing.T) {
+	type nonceKey struct{}
+	type labelKey struct{}
+	var got []string
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		got = append(got, fmt.Sprintf("%v/%v", ctx.Value(nonceKey{}), ctx.Value(labelKey{})))
+		if GetStatus(ctx).TryNumber != len(got) {
+			t.Errorf("status lost on try %d", len(got))
+		}
+		return errors.New("fail")
+	},
+		NoDelay(),
+		MaxTries(3),
+		ContextValueFunc(nonceKey{}, func(try int) any { return try * 10 }),
+		ContextValueFunc(labelKey{}, func(try int) any { return fmt.Sprint("try-", try) }),
+	)
+	if want := "[10/try-1 20/try-2 30/try-3]"; fmt.Sprint(got) != want {
+		t.Fatalf("got values %v, want %v", got, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	}, NoDelay(), MaxTries(3), withClock(newFakeClock(time.Time{})), Summarize(logger.With("op", "foo"), slog.LevelWarn))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1:\n%s", len(lines), buf.String())
+	}
+	if want := `level=WARN msg="retry run ended" op=foo outcome=ReasonExhausted attempts=3 elapsed=0s error=`; !strings.HasPrefix(lines[0], want) || !strings.Contains(lines[0], "fail") {
+		t.Fatalf("got summary:\n%s\nwant prefix:\n%s", lines[0], want)
+	}
+
+	buf.Reset()
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return nil
+	}, Summarize(logger, slog.LevelInfo))
+	if want := `level=INFO msg="retry run ended" outcome=ReasonSuccess attempts=1 elapsed=`; !strings.HasPrefix(buf.String(), want) || strings.Contains(buf.String(), "error=") {
+		t.Fatalf("got summary:\n%s\nwant prefix:\n%s", buf.String(), want)
+	}
+}
+
+func TestCoalesceEach(t *testing.T) {
+	errA := errors.New("a")
+	errs := []error{errA, errA, fmt.Errorf("wrapped: %w", errA), errors.New("b"), errors.New("b"), errA}
+	var calls []string
+	n := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		n++
+		return errs[n-1]
+	},
+		NoDelay(),
+		MaxTries(len(errs)),
+		CoalesceEach(true),
+		Each(func(s Status) {
+			calls = append(calls, fmt.Sprintf("%d:%v×%d", s.TryNumber, s.Err, s.RepeatCount))
+		}),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	// each streak is reported at its start and, if it repeated, its end.
+	want := "[1:a×1 3:wrapped: a×3 4:b×1 5:b×2 6:a×1]"
+	if fmt.Sprint(calls) != want {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+
+	// a streak cut short by success is still reported.
+	calls, n = nil, 0
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		n++
+		if n == 4 {
+			return nil
+		}
+		return errA
+	}, NoDelay(), CoalesceEach(true), Each(func(s Status) {
+		calls = append(calls, fmt.Sprintf("%d×%d", s.TryNumber, s.RepeatCount))
+	}))
+	if want := "[1×1 3×3]"; fmt.Sprint(calls) != want {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errForbidden := errors.New("forbidden")
+	var why []string
+	n := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		n++
+		if n == 1 {
+			return errTimeout
+		}
+		return errForbidden
+	},
+		NoDelay(),
+		MaxTries(3),
+		HaltFn(func(err error) bool { return errors.Is(err, errForbidden) }),
+		Explain(&why),
+	)
+	if !Halted(err) {
+		t.Fatalf("got %v, want halted", err)
+	}
+	want := []string{
+		"attempt 1/3 failed: timeout; continue; delay=0s",
+		"attempt 2/3 failed: forbidden; stop: HaltFn",
+	}
+	if !slices.Equal(why, want) {
+		t.Fatalf("got explanation:\n%s\nwant:\n%s", strings.Join(why, "\n"), strings.Join(want, "\n"))
+	}
+
+	why = nil
+	err = FnCtx(context.Background(), func(context.Context) error {
+		return errTimeout
+	}, NoDelay(), MaxTries(2), Explain(&why))
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	want = []string{
+		"attempt 1/2 failed: timeout; continue; delay=0s",
+		"attempt 2/2 failed: timeout; stop: MaxTries",
+	}
+	if !slices.Equal(why, want) {
+		t.Fatalf("got explanation:\n%s\nwant:\n%s", strings.Join(why, "\n"), strings.Join(want, "\n"))
+	}
+
+	why = nil
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return nil
+	}, MaxTries(2), Explain(&why))
+	if want := []string{"attempt 1/2 succeeded"}; !slices.Equal(why, want) {
+		t.Fatalf("got explanation %q, want %q", why, want)
+	}
+
+	why = nil
+	errStop := errors.New("stop")
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errTimeout
+	}, NoDelay(), MaxTries(3), EachOrHalt(func(Status) error { return errStop }), Explain(&why))
+	if want := []string{"attempt 1/3 failed: timeout; stop: EachOrHalt: stop"}; !slices.Equal(why, want) {
+		t.Fatalf("got explanation %q, want %q", why, want)
+	}
+
+	why = nil
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return nil
+	}, NoDelay(), SkipIfOffline(func() bool { return false }, time.Nanosecond), Explain(&why))
+	if want := []string{"stop: SkipIfOffline: still offline after 1ns"}; !slices.Equal(why, want) {
+		t.Fatalf("got explanation %q, want %q", why, want)
+	}
+
+	why = nil
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return nil
+	}, Validate(func() error { return errForbidden }), Explain(&why))
+	if want := []string{"stop: Validate: forbidden"}; !slices.Equal(why, want) {
+		t.Fatalf("got explanation %q, want %q", why, want)
+	}
+
+	why = nil
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return errTimeout
+	}, MaxTries(2), fixedDelay(150*time.Second), withClock(newFakeClock(time.Time{})), Explain(&why))
+	if want := "attempt 1/2 failed: timeout; continue; delay=2m0s"; len(why) == 0 || why[0] != want {
+		t.Fatalf("got explanation %q, want it to start with %q", why, want)
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	errBusy := errors.New("busy")
+	run := func(after time.Duration, options ...Option) []time.Duration {
+		var delays []time.Duration
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			return RetryAfter(errBusy, after)
+		}, append([]Option{
+			MaxTries(2),
+			withClock(newFakeClock(time.Time{})),
+			Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		}, options...)...)
+		return delays
+	}
+	// the requested delay wins over the options that choose a shorter one.
+	for name, options := range map[string][]Option{
+		"NoDelay":  {NoDelay()},
+		"MaxDelay": {InitialDelay(time.Second), MaxDelay(time.Second)},
+		"PolicyByError": {PolicyByError(func(error) Policy {
+			return Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+		})},
+	} {
+		if got := run(time.Minute, options...); got[0] != time.Minute {
+			t.Errorf("%s: got delays %v, want 1m first", name, got)
+		}
+	}
+	// but it never shortens a delay.
+	if got := run(time.Millisecond, fixedDelay(time.Hour)); got[0] != time.Hour {
+		t.Fatalf("got delays %v, want the longer 1h delay first", got)
+	}
+}
@@ -1,6 +1,18 @@
 package redo
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"andy.dev/redo/backoff"
+)
 
 // Policy allows you to predefine all of the options for a retry run ahead of
 // time and set them using [WithPolicy]
@@ -14,6 +26,9 @@ type Policy struct {
 	// Maximum number of tries to attempt.
 	// Default: 10
 	MaxTries int
+	// Maximum total time for the run -- see [MaxElapsed]
+	// Default: 0 (no limit)
+	MaxElapsed time.Duration
 	// Whether to retry the first time immdiaitely.
 	// Default: false
 	FirstFast bool
@@ -24,3 +39,230 @@ type Policy struct {
 	// NoCtxCause disables automatic extraction of context cause -- see [CtxCause]
 	NoCtxCause bool
 }
+
+// String implements fmt.Stringer, describing the policy on one line so it can
+// be logged at startup, such as:
+//
+//	redo.Policy{initial=1s max=20m0s tries=10 firstFast=false}
+//
+// MaxElapsed and NoCtxCause are only included if set. Function fields are
+// never printed, only noted as "halt=set" or "each=set" if they are non-nil.
+func (p Policy) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "redo.Policy{initial=%v max=%v tries=%d", p.InitialDelay, p.MaxDelay, p.MaxTries)
+	if p.MaxElapsed != 0 {
+		fmt.Fprintf(&b, " elapsed=%v", p.MaxElapsed)
+	}
+	fmt.Fprintf(&b, " firstFast=%t", p.FirstFast)
+	if p.NoCtxCause {
+		b.WriteString(" noCtxCause=true")
+	}
+	if p.Halt != nil {
+		b.WriteString(" halt=set")
+	}
+	if p.Each != nil {
+		b.WriteString(" each=set")
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// PolicyFromMap builds a Policy from string values, such as environment
+// variables or flags, using the following keys:
+//
+//	initial_delay  InitialDelay, as accepted by time.ParseDuration
+//	max_delay      MaxDelay, as accepted by time.ParseDuration
+//	max_tries      MaxTries, as an integer
+//	max_elapsed    MaxElapsed, as accepted by time.ParseDuration
+//	first_fast     FirstFast, as accepted by strconv.ParseBool
+//	no_ctx_cause   NoCtxCause, as accepted by strconv.ParseBool
+//
+// Missing keys are left as zero, so the usual defaults apply. An error is
+// returned for unknown keys, values that cannot be parsed, and negative
+// durations.
+func PolicyFromMap(m map[string]string) (Policy, error) {
+	var p Policy
+	keys := slices.Sorted(maps.Keys(m))
+	for _, key := range keys {
+		var err error
+		value := m[key]
+		switch key {
+		case "initial_delay":
+			p.InitialDelay, err = parsePolicyDuration(value)
+		case "max_delay":
+			p.MaxDelay, err = parsePolicyDuration(value)
+		case "max_elapsed":
+			p.MaxElapsed, err = parsePolicyDuration(value)
+		case "max_tries":
+			p.MaxTries, err = strconv.Atoi(value)
+		case "first_fast":
+			p.FirstFast, err = strconv.ParseBool(value)
+		case "no_ctx_cause":
+			p.NoCtxCause, err = strconv.ParseBool(value)
+		default:
+			return Policy{}, fmt.Errorf("redo: unknown policy key %q", key)
+		}
+		if err != nil {
+			return Policy{}, fmt.Errorf("redo: policy key %q: %w", key, err)
+		}
+	}
+	return p, nil
+}
+
+func parsePolicyDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %v", d)
+	}
+	return d, nil
+}
+
+// SuccessProbability returns the probability that a run with the given
+// MaxTries succeeds, if each try succeeds with probability perAttempt:
+//
+//	1 - (1-perAttempt)^maxTries
+//
+// This assumes that tries are independent, which is optimistic, since a
+// failure often makes the next one more likely; see
+// [SuccessProbabilityCorrelated]. A maxTries <= 0 is treated as unlimited.
+func SuccessProbability(perAttempt float64, maxTries int) float64 {
+	return SuccessProbabilityCorrelated(perAttempt, maxTries, 0)
+}
+
+// SuccessProbabilityCorrelated works like [SuccessProbability], but accounts for
+// correlated failures, where correlation, from 0 to 1, is the chance that a
+// failure carries over to the next try regardless of perAttempt, such as an
+// outage that outlasts the delay. With a correlation of 0, tries are
+// independent, and with 1, retries never help, so the result is perAttempt.
+// Arguments outside of [0, 1] are clamped to it.
+func SuccessProbabilityCorrelated(perAttempt float64, maxTries int, correlation float64) float64 {
+	p := min(max(perAttempt, 0), 1)
+	c := min(max(correlation, 0), 1)
+	// the chance that a try fails, given that the one before it failed.
+	again := 1 - p*(1-c)
+	if maxTries <= 0 {
+		if again < 1 {
+			return 1
+		}
+		return p
+	}
+	return 1 - (1-p)*math.Pow(again, float64(maxTries-1))
+}
+
+// SuccessProbability returns the probability that a run using the policy
+// succeeds if each try succeeds with probability perAttempt and the tries are
+// independent, as with the package-level [SuccessProbability]. If MaxTries is
+// 0, DefaultMaxTries is used.
+func (p Policy) SuccessProbability(perAttempt float64) float64 {
+	tries := p.MaxTries
+	if tries == 0 {
+		tries = DefaultMaxTries
+	}
+	return SuccessProbability(perAttempt, tries)
+}
+
+var defaultPolicy atomic.Pointer[Policy]
+
+// SetDefaultPolicy sets a Policy that will be applied to every run before any
+// options passed to the retrier, so that an application can configure
+// consistent retry behavior in one place. Options passed to a retrier always
+// override the default policy, including [WithPolicy], which replaces it
+// entirely.
+//
+// Since this is global state shared by every user of the package in the
+// program, it should only be called once, during initialization, by the main
+// package. It is safe to call concurrently with running retriers, but runs
+// that have already started will not be affected.
+func SetDefaultPolicy(p Policy) {
+	defaultPolicy.Store(&p)
+}
+
+// Escalate retries fn using each of the policies in turn, moving on to the
+// next policy only if the previous one was exhausted, which allows for tiered
+// retries such as a few fast local retries followed by slower cross-region
+// ones. The run ends at the first success, or when a policy ends for any
+// reason other than exhaustion, such as a halt or cancellation. If every
+// policy is exhausted, the error from the last one is returned. Each policy
+// starts a new run, so [Status].TryNumber will start over from 1 for each.
+// If no policies are given, fn is retried using the defaults.
+func Escalate(ctx context.Context, fn func(context.Context) error, policies ...Policy) error {
+	if len(policies) == 0 {
+		return FnCtx(ctx, fn)
+	}
+	var err error
+	for _, p := range policies {
+		err = FnCtx(ctx, fn, WithPolicy(p))
+		if !Exhausted(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// PolicyByError chooses the pacing of the run from the error each try fails
+// with, for an operation that can fail in categorically different ways, such
+// as a long backoff for a rate limit and a short one for an unavailable
+// service:
+//
+//	redo.PolicyByError(func(err error) redo.Policy {
+//	    if errors.Is(err, errRateLimited) {
+//	        return redo.Policy{InitialDelay: 10 * time.Second, MaxTries: 20}
+//	    }
+//	    return redo.Policy{InitialDelay: 100 * time.Millisecond, MaxTries: 5}
+//	})
+//
+// Only the InitialDelay, MaxDelay and MaxTries fields of the returned policy
+// are used, and any left as zero fall back to the run's own settings. Each
+// distinct InitialDelay and MaxDelay pair keeps its own backoff, which only
+// advances when a delay is taken from it, so switching between categories
+// resumes each one's curve where it left off.
+//
+// MaxTries counts every try in the run, not only those made under the current
+// policy, and the policy chosen for the latest failure decides whether the run
+// is exhausted. A run that has made 8 tries under a policy allowing 20, and
+// then fails in a way that selects a policy allowing 5, is exhausted at once.
+// If [BudgetFromFirstLatency] has lowered MaxTries, the smaller of the two
+// applies. Options that shape each delay, such as [QuantizeDelay], still
+// apply. Defaults to nil, which uses the run's own settings for every failure.
+func PolicyByError(selector func(error) Policy) Option {
+	return func(o *opts) {
+		o.policyByErr = selector
+	}
+}
+
+// errPolicy returns the delay before the next try and the maximum number of
+// tries for the policy selected for err by PolicyByError.
+func (o *opts) errPolicy(err error, try int) (time.Duration, int) {
+	if o.errPolicyTries == 0 {
+		// the run's own setting, before any policy has replaced it.
+		o.errPolicyTries = o.maxTries
+	}
+	p := o.policyByErr(err)
+	key := [2]time.Duration{p.InitialDelay, p.MaxDelay}
+	if key[0] <= 0 {
+		key[0] = o.initialDelay
+	}
+	if key[1] <= 0 {
+		key[1] = max(o.maxDelay, key[0])
+	}
+	delays, ok := o.errPolicyDelays[key]
+	if !ok {
+		delays = backoff.New(key[0], key[1], false, backoff.WithRand(o.rnd))
+		if o.errPolicyDelays == nil {
+			o.errPolicyDelays = make(map[[2]time.Duration]backoff.Iterator)
+		}
+		o.errPolicyDelays[key] = delays
+	}
+	maxTries := p.MaxTries
+	if maxTries == 0 {
+		maxTries = o.errPolicyTries
+	}
+	if o.budgetMax > 0 && (maxTries < 0 || maxTries > o.budgetMax) {
+		// a policy can't undo the limit set by BudgetFromFirstLatency.
+		maxTries = o.budgetMax
+	}
+	return o.adjustDelay(o.taper(delays(), try+1)), maxTries
+}
@@ -0,0 +1,248 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSetDefaultPolicy(t *testing.T) {
+	t.Cleanup(func() { defaultPolicy.Store(nil) })
+	SetDefaultPolicy(Policy{
+		InitialDelay: time.Millisecond,
+		MaxTries:     2,
+	})
+	tries := 0
+	err := Fn(context.Background(), func() error {
+		tries++
+		return errors.New("fail")
+	})
+	if !Exhausted(err) || tries != 2 {
+		t.Fatalf("got %d tries (%v), want 2 from default policy", tries, err)
+	}
+
+	tries = 0
+	_ = Fn(context.Background(), func() error {
+		tries++
+		return errors.New("fail")
+	}, MaxTries(3))
+	if tries != 3 {
+		t.Fatalf("got %d tries, want 3 from explicit option", tries)
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	fast := Policy{InitialDelay: time.Microsecond, MaxTries: 2}
+	slow := Policy{InitialDelay: time.Millisecond, MaxTries: 3}
+
+	tries := 0
+	err := Escalate(context.Background(), func(context.Context) error {
+		tries++
+		return errors.New("fail")
+	}, fast, slow)
+	if !Exhausted(err) || tries != 5 {
+		t.Fatalf("got %d tries (%v), want 5 and exhausted", tries, err)
+	}
+
+	tries = 0
+	err = Escalate(context.Background(), func(context.Context) error {
+		tries++
+		if tries == 4 {
+			return nil
+		}
+		return errors.New("fail")
+	}, fast, slow)
+	if err != nil || tries != 4 {
+		t.Fatalf("got %d tries (%v), want success on try 4", tries, err)
+	}
+
+	tries = 0
+	err = Escalate(context.Background(), func(context.Context) error {
+		tries++
+		return Halt(errors.New("fatal"))
+	}, fast, slow)
+	if !Halted(err) || tries != 1 {
+		t.Fatalf("got %d tries (%v), want a halt without escalation", tries, err)
+	}
+}
+
+func TestPolicyString(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Policy
+		want string
+	}{
+		{
+			name: "partial",
+			p:    Policy{InitialDelay: time.Second, MaxDelay: 20 * time.Minute, MaxTries: 10},
+			want: "redo.Policy{initial=1s max=20m0s tries=10 firstFast=false}",
+		},
+		{
+			name: "full",
+			p: Policy{
+				InitialDelay: 100 * time.Millisecond,
+				MaxDelay:     time.Minute,
+				MaxTries:     5,
+				MaxElapsed:   time.Hour,
+				FirstFast:    true,
+				Halt:         func(error) bool { return false },
+				Each:         func(Status) {},
+				NoCtxCause:   true,
+			},
+			want: "redo.Policy{initial=100ms max=1m0s tries=5 elapsed=1h0m0s firstFast=true noCtxCause=true halt=set each=set}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFromMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    Policy
+		wantErr string
+	}{
+		{
+			name: "full",
+			m: map[string]string{
+				"initial_delay": "250ms",
+				"max_delay":     "1m",
+				"max_tries":     "5",
+				"max_elapsed":   "1h",
+				"first_fast":    "true",
+				"no_ctx_cause":  "1",
+			},
+			want: Policy{
+				InitialDelay: 250 * time.Millisecond,
+				MaxDelay:     time.Minute,
+				MaxTries:     5,
+				MaxElapsed:   time.Hour,
+				FirstFast:    true,
+				NoCtxCause:   true,
+			},
+		},
+		{name: "missing keys", m: map[string]string{"max_tries": "-1"}, want: Policy{MaxTries: -1}},
+		{name: "empty", m: nil, want: Policy{}},
+		{name: "bad duration", m: map[string]string{"initial_delay": "soon"}, wantErr: `redo: policy key "initial_delay": time: invalid duration "soon"`},
+		{name: "negative duration", m: map[string]string{"max_delay": "-1s"}, wantErr: `redo: policy key "max_delay": negative duration -1s`},
+		{name: "bad int", m: map[string]string{"max_tries": "ten"}, wantErr: `redo: policy key "max_tries": strconv.Atoi: parsing "ten": invalid syntax`},
+		{name: "bad bool", m: map[string]string{"first_fast": "maybe"}, wantErr: `redo: policy key "first_fast": strconv.ParseBool: parsing "maybe": invalid syntax`},
+		{name: "unknown key", m: map[string]string{"max_retries": "3"}, wantErr: `redo: unknown policy key "max_retries"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PolicyFromMap(tt.m)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.String() != tt.want.String() {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuccessProbability(t *testing.T) {
+	tests := []struct {
+		perAttempt  float64
+		maxTries    int
+		correlation float64
+		want        float64
+	}{
+		{0.5, 3, 0, 0.875},
+		{0.9, 2, 0, 0.99},
+		{0.5, 1, 0, 0.5},
+		{0, 10, 0, 0},
+		{1, 10, 0, 1},
+		{0.5, -1, 0, 1},
+		// fully correlated failures make retrying pointless.
+		{0.5, 3, 1, 0.5},
+		{0.5, -1, 1, 0.5},
+		// half of failures persist: 1 - 0.5 * 0.75^2
+		{0.5, 3, 0.5, 0.71875},
+		// out of range values are clamped.
+		{1.5, 3, -1, 1},
+	}
+	for _, tt := range tests {
+		got := SuccessProbabilityCorrelated(tt.perAttempt, tt.maxTries, tt.correlation)
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("SuccessProbabilityCorrelated(%v, %d, %v) = %v, want %v", tt.perAttempt, tt.maxTries, tt.correlation, got, tt.want)
+		}
+	}
+	if got := SuccessProbability(0.5, 3); got != 0.875 {
+		t.Errorf("SuccessProbability(0.5, 3) = %v, want 0.875", got)
+	}
+	if got, want := (Policy{}).SuccessProbability(0.5), 1-math.Pow(0.5, DefaultMaxTries); got != want {
+		t.Errorf("got %v for the default policy, want %v", got, want)
+	}
+}
+
+func TestPolicyByError(t *testing.T) {
+	errLimited := errors.New("rate limited")
+	errUnavailable := errors.New("unavailable")
+	selector := func(err error) Policy {
+		if errors.Is(err, errLimited) {
+			return Policy{InitialDelay: time.Minute, MaxDelay: time.Minute, MaxTries: 20}
+		}
+		return Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxTries: 5}
+	}
+
+	// the category of each failure sets the delay after it.
+	errs := []error{errLimited, errUnavailable, errLimited, errUnavailable}
+	var delays []time.Duration
+	n := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		n++
+		return errs[(n-1)%len(errs)]
+	},
+		PolicyByError(selector),
+		MaxTries(len(errs)),
+		Each(func(s Status) { delays = append(delays, s.NextDelay) }),
+		withClock(newFakeClock(time.Now())),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	for i, d := range delays[:3] {
+		if limited := i%2 == 0; limited != (d > time.Second) {
+			t.Fatalf("got delay %v after %v", d, errs[i])
+		}
+	}
+
+	// MaxTries counts every try in the run, whichever policy is chosen.
+	n = 0
+	err = FnCtx(context.Background(), func(context.Context) error {
+		n++
+		if n <= 6 {
+			return errLimited
+		}
+		return errUnavailable
+	}, PolicyByError(selector), withClock(newFakeClock(time.Now())))
+	if !errors.Is(err, errUnavailable) || !Exhausted(err) || n != 7 {
+		t.Fatalf("got %v after %d tries, want exhausted after 7", err, n)
+	}
+
+	// a zero MaxTries falls back to the run's own.
+	n = 0
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		n++
+		return errUnavailable
+	}, PolicyByError(func(error) Policy { return Policy{} }), NoDelay(), MaxTries(3))
+	if n != 3 {
+		t.Fatalf("got %d tries, want 3", n)
+	}
+}
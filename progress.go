@@ -0,0 +1,92 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+type progressCtxKey struct{}
+
+// Progress records the progress reported by a function being retried with
+// [ReportProgress], so that it can be used to resume from where a failed try
+// left off. The usual pattern is to pass it to a run with [TrackProgress] and
+// read it from a [RefreshFn], so that the refreshed argument picks up where
+// the last try stopped:
+//
+//	var p redo.Progress
+//	err := redo.FnInCtxRefr(ctx, uploadFrom, 0, func() (int64, error) {
+//	    return p.Load(), nil
+//	}, redo.TrackProgress(&p))
+//
+// Inside uploadFrom, each chunk that completes is recorded with
+// redo.ReportProgress(ctx, offset).
+//
+// The zero value is ready to use, and it is safe for concurrent use.
+type Progress struct {
+	v atomic.Int64
+}
+
+// Load returns the most recently reported progress.
+func (p *Progress) Load() int64 {
+	return p.v.Load()
+}
+
+// TrackProgress records any progress reported with [ReportProgress] by the
+// function being retried in p. Defaults to nil, which ignores it.
+func TrackProgress(p *Progress) Option {
+	return func(o *opts) {
+		o.progress = p
+	}
+}
+
+// ReportProgress records n as the progress of the current try, such as the
+// number of bytes or items that have been completed, in the [*Progress] set
+// with [TrackProgress]. It does nothing if ctx is not from a run that is
+// tracking progress.
+func ReportProgress(ctx context.Context, n int64) {
+	if run, ok := ctx.Value(progressCtxKey{}).(*runState); ok && run.tracked != nil {
+		run.tracked.v.Store(n)
+	}
+}
+
+// SetProgress records how close the current try has come to succeeding, as a
+// fraction from 0 to 1, such as the share of records synced so far. The last
+// value set during a run is carried by the error the run ends with if it is
+// exhausted, and can be retrieved with [LastProgress] or the error's
+// Progress method, to help decide whether a follow-up run is worthwhile. It
+// does nothing if ctx is not from a run, or the run was made with
+// [DisableStatusContext] and without [TrackProgress].
+func SetProgress(ctx context.Context, fraction float64) {
+	if run, ok := ctx.Value(progressCtxKey{}).(*runState); ok {
+		run.fraction.Store(&fraction)
+	}
+}
+
+// LastProgress returns the last fraction set with [SetProgress] during the run
+// that returned err, if err or any error it wraps is an exhausted error and
+// progress was set.
+func LastProgress(err error) (float64, bool) {
+	var ee *exhaustedErr
+	if errors.As(err, &ee) && ee.status.run != nil {
+		if f := ee.status.run.fraction.Load(); f != nil {
+			return *f, true
+		}
+	}
+	return 0, false
+}
+
+// runState holds state shared by every try of a single run, which is found
+// from each try's context by both SetProgress and ReportProgress.
+type runState struct {
+	// last fraction set with SetProgress
+	fraction atomic.Pointer[float64]
+	// where to record progress reported with ReportProgress
+	tracked *Progress
+	// start of the run, adjusted by ResumeFrom, as given by now
+	start time.Time
+	now   func() time.Time
+	// MaxElapsed of the run, for RemainingBudget
+	maxElapsed time.Duration
+}
@@ -0,0 +1,83 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProgressResume(t *testing.T) {
+	const chunks = 10
+	var (
+		p        Progress
+		uploaded []int64
+		failAt   = map[int64]bool{4: true, 7: true}
+	)
+	upload := func(ctx context.Context, offset int64) error {
+		for i := offset; i < chunks; i++ {
+			if failAt[i] {
+				delete(failAt, i)
+				return errors.New("connection reset")
+			}
+			uploaded = append(uploaded, i)
+			ReportProgress(ctx, i+1)
+		}
+		return nil
+	}
+	err := FnInCtxRefr(context.Background(), upload, 0, func() (int64, error) {
+		return p.Load(), nil
+	}, InitialDelay(time.Millisecond), TrackProgress(&p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != chunks {
+		t.Fatalf("uploaded %v, want each of %d chunks once", uploaded, chunks)
+	}
+	for i, c := range uploaded {
+		if c != int64(i) {
+			t.Fatalf("uploaded %v, want each of %d chunks once, in order", uploaded, chunks)
+		}
+	}
+
+	// reporting outside of a tracked run is a no-op
+	ReportProgress(context.Background(), 1)
+}
+
+func TestSetProgress(t *testing.T) {
+	tries := 0
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		tries++
+		SetProgress(ctx, float64(tries)/10)
+		return errors.New("sync interrupted")
+	}, NoDelay(), MaxTries(3))
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if f, ok := LastProgress(err); !ok || f != 0.3 {
+		t.Fatalf("got progress %v, %v; want 0.3, true", f, ok)
+	}
+	if f := err.(interface{ Progress() float64 }).Progress(); f != 0.3 {
+		t.Fatalf("got Progress() %v, want 0.3", f)
+	}
+
+	// both kinds of progress can be reported by the same run.
+	var p Progress
+	err = FnCtx(context.Background(), func(ctx context.Context) error {
+		ReportProgress(ctx, 9)
+		SetProgress(ctx, 0.9)
+		return errors.New("sync interrupted")
+	}, NoDelay(), MaxTries(2), TrackProgress(&p), DisableStatusContext())
+	if f, ok := LastProgress(err); !ok || f != 0.9 || p.Load() != 9 {
+		t.Fatalf("got progress %v, %v (tracked %d); want 0.9, true (9)", f, ok, p.Load())
+	}
+
+	err = FnCtx(context.Background(), func(ctx context.Context) error {
+		return errors.New("fail")
+	}, NoDelay(), MaxTries(2))
+	if _, ok := LastProgress(err); ok {
+		t.Fatal("expected no progress for a run that never set it")
+	}
+	// outside of a run, it does nothing.
+	SetProgress(context.Background(), 1)
+}
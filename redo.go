@@ -3,6 +3,10 @@ package redo
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
 	"time"
 
 	"andy.dev/redo/backoff"
@@ -14,6 +18,21 @@ const (
 	DefaultMaxTries     = 10
 )
 
+// MinDelay is the shortest delay that will be used between tries, to prevent
+// a very small [InitialDelay] from turning the retry loop into a busy loop.
+// Any shorter delay will be raised to MinDelay, unless it is zero, such as with
+// [FirstFast], or MaxDelay is lower. It can be disabled with
+// [AllowSubMillisecondDelays].
+const MinDelay = 1 * time.Millisecond
+
+// WindowPollInterval is how often a run waiting on a [Window] to open will
+// check it again.
+const WindowPollInterval = 1 * time.Minute
+
+// TaperTries is the number of tries at the end of a run whose delays are
+// shortened by [TaperToEnd].
+const TaperTries = 3
+
 type RetryFn interface {
 	func() error | func(context.Context) error
 }
@@ -159,57 +178,520 @@ func FnCtx(
 	options ...Option,
 ) error {
 	opts := &opts{}
+	if p := defaultPolicy.Load(); p != nil {
+		WithPolicy(*p)(opts)
+	}
 	for _, o := range options {
 		o(opts)
 	}
+	// the error that ends the run before its first try, if any.
+	var early error
+	if opts.retrier != nil && !opts.retrier.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, opts.retrier.deadline)
+		defer cancel()
+		if ctx.Err() != nil {
+			opts.explainf("stop: Retrier deadline passed")
+			early = opts.ctxErr(ctx)
+		}
+	}
+	autoTries := opts.autoTries && opts.maxTries == 0
 	applyDefaults(opts)
-	backoff := backoff.New(opts.initialDelay, opts.maxDelay, opts.firstFast)
-	t := time.NewTimer(DefaultMaxDelay)
-	t.Stop()
+	if deadline, ok := ctx.Deadline(); ok && autoTries {
+		opts.maxTries = estimateTries(deadline.Sub(opts.clock.Now()), opts)
+	}
+	if _, ok := ctx.Deadline(); early == nil && opts.requireBounded && !ok && opts.maxTries < 0 && opts.maxElapsed <= 0 {
+		opts.explainf("stop: RequireBoundedRun")
+		early = ErrUnbounded
+	}
+	if opts.retrier != nil {
+		opts.retrier.begin(opts)
+	}
+	if opts.expvars != nil {
+		opts.expvars.Add("runs", 1)
+	}
+	runStart := opts.clock.Now()
+	err := early
+	if early != nil {
+		// the run still ends as usual, having made no tries.
+		if opts.attemptsPtr != nil {
+			*opts.attemptsPtr = 0
+		}
+	} else {
+		runCtx, cancelRun := ctx, context.CancelCauseFunc(nil)
+		if opts.cancelOnTerminal {
+			runCtx, cancelRun = context.WithCancelCause(ctx)
+		}
+		err = retry(runCtx, fn, opts)
+		if cancelRun != nil {
+			// cancel on success too, so that the run's context is released
+			// from ctx rather than staying linked to it until ctx ends.
+			cancelRun(err)
+		}
+	}
+	if opts.retrier != nil {
+		opts.retrier.end(err, opts.attemptsMade)
+	}
+	if opts.expvars != nil {
+		if err == nil {
+			opts.expvars.Add("successes", 1)
+		} else {
+			opts.expvars.Add("give_ups", 1)
+		}
+	}
+	opts.summarize(ctx, err, opts.clock.Now().Sub(runStart))
+	return err
+}
+
+// FnUntilCtxDone retries fn as with [FnCtx], but ignores [MaxTries] and keeps
+// retrying until fn succeeds, the run is halted, or ctx is done, so that the
+// run uses all of the time available under ctx's deadline. ctx should have a
+// deadline, or be cancelled by some other means, since otherwise fn may be
+// retried forever.
+//
+// [PolicyByError] still sets the delay for each error, but not the number of
+// tries, and [BudgetFromFirstLatency] has no effect.
+//
+// When ctx ends the run after at least one failure, the error returned is an
+// exhausted error wrapping the most recent error returned by fn before ctx was
+// done, rather than the context's error, so that [Exhausted] reports true and
+// the reason for the failures is not lost.
+func FnUntilCtxDone(ctx context.Context, fn func(context.Context) error, options ...Option) error {
+	return FnCtx(ctx, fn, append(options[:len(options):len(options)], MaxTries(-1), func(o *opts) {
+		o.untilCtxDone = true
+	})...)
+}
+
+// retry runs the retry loop for fn with the fully configured opts.
+func retry(ctx context.Context, fn func(context.Context) error, opts *opts) error {
+	newBackoff := func() backoff.Iterator {
+		return opts.newBackoff(backoff.WithRand(opts.rnd))
+	}
+	backoff := newBackoff()
 	try := 0
-	var lastErr error
+	nextDelay := func() time.Duration {
+		if opts.shared != nil {
+			// the shared backoff only advances once a try fails.
+			return opts.adjustDelay(opts.taper(opts.shared.Last(), try+1))
+		}
+		return opts.adjustDelay(opts.taper(backoff(), try+1))
+	}
+	t := opts.clock.NewTimer(DefaultMaxDelay)
+	t.Stop()
+	start := opts.clock.Now().Add(-opts.resumeElapsed)
+	if opts.startAttempt > 1 {
+		// resume the count, and the curve, where a previous run left off.
+		try = opts.startAttempt - 1
+		for range try {
+			backoff()
+		}
+	}
+	runID := opts.newRunID()
+	run := &runState{tracked: opts.progress, start: start, now: opts.clock.Now, maxElapsed: opts.maxElapsed}
+	attempts := 0
+	defer func() {
+		opts.attemptsMade = attempts
+		if opts.attemptsPtr != nil {
+			*opts.attemptsPtr = attempts
+		}
+	}()
+	if opts.validateFn != nil {
+		if err := opts.validateFn(); err != nil {
+			opts.explainf("stop: Validate: %v", err)
+			return Halt(err)
+		}
+	}
+	var (
+		lastErr      = opts.resumedErr()
+		lastDuration time.Duration
+		// the most recent failure that was not caused by ctx being done
+		lastFailure error
+		// the keys of the errors seen, for MaxDistinctErrors
+		distinct map[string]struct{}
+		// the delay before the current try
+		lastDelay time.Duration
+		// releases the run's place in the DependencyLimiter, once it has one
+		depRelease func()
+	)
+	callEach := func(ctx context.Context, status Status) {
+		if opts.eachFn != nil {
+			opts.eachFn(status)
+		}
+		if opts.eachCtxFn != nil {
+			opts.eachCtxFn(ctx, status)
+		}
+	}
+	var (
+		// the number of consecutive identical failures, for CoalesceEach
+		repeats int
+		// the last failure suppressed by CoalesceEach, if not yet reported
+		coalesced *pendingEach
+	)
+	flushEach := func() {
+		if coalesced != nil {
+			callEach(coalesced.ctx, coalesced.status)
+			coalesced = nil
+		}
+	}
+	defer flushEach()
+	// ctxDone returns the error to end the run with once ctx is done.
+	ctxDone := func(status Status) error {
+		if opts.untilCtxDone && lastFailure != nil {
+			return errExhausted(lastFailure, status, opts.exhaustedFmt)
+		}
+		return opts.ctxErr(ctx)
+	}
 	for {
 		// prefetch the next delay so that the user can see it in the stats.
-		delay := backoff()
+		delay := nextDelay()
 		status := Status{
-			TryNumber: try + 1,
-			MaxTries:  opts.maxTries,
-			Err:       lastErr,
-			NextDelay: delay,
+			TryNumber:    try + 1,
+			MaxTries:     opts.maxTries,
+			Err:          lastErr,
+			NextDelay:    delay,
+			LastDuration: lastDuration,
+			FastRetry:    attempts > 0 && lastDelay == 0,
+
+			nextLayout: opts.nextLayout,
+			runID:      runID,
+			run:        run,
+		}
+		if opts.shuttingDown() {
+			opts.explainf("stop: OnShutdown before %s", status)
+			return shuttingDown(lastErr)
+		}
+		if err := waitPaused(ctx, opts); err != nil {
+			return err
+		}
+		if err := waitWindow(ctx, opts); err != nil {
+			return err
+		}
+		if err := waitOnline(ctx, opts); err != nil {
+			return err
+		}
+		rctx := ctx
+		if !opts.noStatusCtx {
+			rctx = context.WithValue(ctx, retryCtxKey{}, status)
 		}
-		rctx := context.WithValue(ctx, retryCtxKey, status)
+		if !opts.noStatusCtx || opts.progress != nil {
+			rctx = context.WithValue(rctx, progressCtxKey{}, run)
+		}
+		for _, cv := range opts.ctxValues {
+			rctx = context.WithValue(rctx, cv.key, cv.gen(status.TryNumber))
+		}
+		if opts.loggerExtract != nil {
+			if logger := opts.loggerExtract(ctx); logger != nil {
+				rctx = opts.loggerStore(rctx, logger.With(slog.Any("retry", status)))
+			}
+		}
+		attempts++
+		if opts.retrier != nil {
+			opts.retrier.attempts.Add(1)
+		}
+		if opts.expvars != nil {
+			opts.expvars.Add("attempts", 1)
+		}
+		opts.emit(AttemptStarted, status, nil)
+		tryStart := opts.clock.Now()
 		lastErr = fn(rctx)
-		if lastErr == nil {
+		lastDuration = opts.clock.Now().Sub(tryStart)
+		status.LastDuration = lastDuration
+		if opts.slowFn != nil && lastDuration > opts.slowThreshold {
+			opts.slowFn(status, lastDuration)
+		}
+		if lastErr != nil && opts.mapErrFn != nil {
+			lastErr = opts.mapErrFn(lastErr)
+		}
+		if lastErr == nil || (opts.successFn != nil && opts.successFn(lastErr)) {
+			if opts.shared != nil {
+				opts.shared.Reset()
+			}
+			opts.explainf("%s succeeded", status)
+			if attempts == 1 && opts.firstOutcome != nil {
+				opts.firstOutcome(nil)
+			}
 			return nil
 		}
+		if opts.shared != nil {
+			delay = opts.adjustDelay(opts.taper(opts.shared.Next(), try+1))
+			status.NextDelay = delay
+		}
+		if opts.budgetTarget > 0 && attempts == 1 && !opts.untilCtxDone {
+			// count from where the run started, in case it was resumed.
+			tries := try + opts.budgetTries(opts.budgetTarget-opts.clock.Now().Sub(start), lastDuration, delay)
+			if opts.maxTries <= 0 || tries < opts.maxTries {
+				opts.maxTries = tries
+				opts.budgetMax = tries
+				status.MaxTries = tries
+			}
+		}
+		if opts.resetEqualFn != nil && status.Err != nil && !opts.resetEqualFn(status.Err, lastErr) {
+			// the failure has changed, so start over from the bottom of the curve.
+			backoff = newBackoff()
+			delay = nextDelay()
+			status.NextDelay = delay
+		}
+		if opts.policyByErr != nil {
+			var maxTries int
+			delay, maxTries = opts.errPolicy(lastErr, try)
+			if !opts.untilCtxDone {
+				// only ctx ends the run for FnUntilCtxDone.
+				opts.maxTries = maxTries
+			}
+			status.NextDelay = delay
+			status.MaxTries = opts.maxTries
+		}
+		if after, ok := retryAfterOf(lastErr); ok && after > delay {
+			delay = after
+			status.NextDelay = delay
+		}
+		if opts.coalesceEach {
+			if attempts > 1 && sameErr(lastErr, status.Err) {
+				repeats++
+			} else {
+				repeats = 1
+			}
+			status.RepeatCount = repeats
+		}
 		status.Err = lastErr
-		if opts.eachFn != nil {
-			opts.eachFn(status)
+		if ctx.Err() == nil {
+			lastFailure = lastErr
+		}
+		opts.emit(AttemptFailed, status, lastErr)
+		each := func() {
+			if opts.coalesceEach {
+				if status.RepeatCount > 1 {
+					// report the end of the streak later, once it is known.
+					coalesced = &pendingEach{ctx: rctx, status: status}
+					return
+				}
+				flushEach()
+			}
+			callEach(rctx, status)
+		}
+		if !opts.eachSkipTerminal {
+			each()
+		}
+		if opts.traceW != nil {
+			fmt.Fprintf(opts.traceW, "%s: error=%v next=%v\n", status, status.Err, shortNext(status.NextDelay))
+		}
+		if opts.eachHaltFn != nil {
+			if err := opts.eachHaltFn(status); err != nil {
+				opts.explainf("%s failed: %v; stop: EachOrHalt: %v", status, lastErr, err)
+				return Halt(err)
+			}
 		}
 		try++
-		switch {
-		case errors.Is(lastErr, context.Canceled) || errors.Is(lastErr, context.DeadlineExceeded):
-			if opts.noCause || context.Cause(ctx) == nil {
+		// a context error from the final try is only reported as such if it
+		// came from ctx itself. If it came from a context the function
+		// derived, the run is exhausted, wrapping the context error.
+		lastTry := opts.maxTries > 0 && try >= opts.maxTries
+		// the option or condition that ended the run, for Explain
+		var why string
+		endErr := func() error {
+			switch {
+			case (errors.Is(lastErr, context.Canceled) || errors.Is(lastErr, context.DeadlineExceeded)) && (ctx.Err() != nil || !lastTry):
+				why = "context done"
+				if opts.untilCtxDone && ctx.Err() != nil && lastFailure != nil {
+					return ctxDone(status)
+				}
+				if opts.noCause || context.Cause(ctx) == nil {
+					return lastErr
+				}
+				return context.Cause(ctx)
+			case Halted(lastErr):
+				why = "halted by the function"
 				return lastErr
+			case RefreshFailed(lastErr):
+				why = "refresh failed"
+				return lastErr
+			case opts.haltFn != nil && opts.haltFn(lastErr):
+				why = "HaltFn"
+				return Halt(lastErr)
+			case opts.haltStatusFn != nil && opts.haltStatusFn(lastErr, status):
+				why = "HaltFnStatus"
+				return Halt(lastErr)
+			case opts.maxDistinct > 0 && opts.tooManyDistinct(&distinct, lastErr):
+				why = "MaxDistinctErrors"
+				return Halt(lastErr)
+			case lastTry:
+				why = "MaxTries"
+				return errExhausted(lastErr, status, opts.exhaustedFmt)
+			case opts.maxElapsed > 0 && opts.clock.Now().Sub(start)+delay > opts.maxElapsed:
+				why = "MaxElapsed"
+				return errExhausted(lastErr, status, opts.exhaustedFmt)
+			case opts.loadShedFn != nil && opts.loadShedFn():
+				why = "LoadShed"
+				return Halt(fmt.Errorf("%w: %w", ErrLoadShed, lastErr))
 			}
-			return context.Cause(ctx)
-		case Halted(lastErr):
-			return lastErr
-		case opts.haltFn != nil && opts.haltFn(lastErr):
-			return Halt(lastErr)
-		case opts.maxTries > 0 && try == opts.maxTries:
-			return errExhausted(lastErr)
+			return nil
+		}()
+		if endErr != nil {
+			opts.explainf("%s failed: %v; stop: %s", status, lastErr, why)
+			if opts.finalFn != nil && Exhausted(endErr) && ctx.Err() == nil {
+				attempts++
+				if opts.retrier != nil {
+					opts.retrier.attempts.Add(1)
+				}
+				if opts.expvars != nil {
+					opts.expvars.Add("attempts", 1)
+				}
+				if opts.finalFn(rctx) == nil {
+					opts.explainf("final attempt succeeded")
+					if opts.final != nil {
+						opts.final.ok = true
+					}
+					return nil
+				}
+				opts.explainf("final attempt failed")
+			}
+			return endErr
 		}
+		if opts.depLimiter != nil && depRelease == nil {
+			var ok bool
+			if depRelease, ok = opts.depLimiter.acquire(ctx, opts.depName, opts.shutdown); !ok {
+				if ctx.Err() != nil {
+					opts.explainf("%s failed: %v; stop: context done while queued by DependencyLimiter", status, lastErr)
+					return ctxDone(status)
+				}
+				if opts.shuttingDown() {
+					opts.explainf("%s failed: %v; stop: OnShutdown while queued by DependencyLimiter", status, lastErr)
+					return shuttingDown(lastErr)
+				}
+				opts.explainf("%s failed: %v; stop: DependencyLimiter", status, lastErr)
+				return Halt(fmt.Errorf("%w: %w", ErrDependencyBusy, lastErr))
+			}
+			defer depRelease()
+		}
+		if opts.eachSkipTerminal {
+			each()
+		}
+		lastDelay = delay
+		if opts.shuttingDown() {
+			opts.explainf("%s failed: %v; stop: OnShutdown", status, lastErr)
+			return shuttingDown(lastErr)
+		}
+		opts.explainf("%s failed: %v; continue; delay=%v", status, lastErr, shortNext(delay))
+		if attempts == 1 && opts.firstOutcome != nil {
+			opts.firstOutcome(lastErr)
+		}
+		opts.emit(Sleeping, status, nil)
+		if delay == 0 {
+			// no need for a timer, but yield so that a tight loop does not
+			// starve other goroutines.
+			runtime.Gosched()
+			opts.slept(0, 0)
+			if ctx.Err() != nil {
+				opts.explainf("stop: context done")
+				return ctxDone(status)
+			}
+			continue
+		}
+		sleepStart := opts.clock.Now()
 		t.Reset(delay)
 		select {
 		case <-ctx.Done():
-			if !t.Stop() {
-				<-t.C
-			}
-			return context.Cause(ctx)
-		case <-t.C:
+		case <-opts.shutdown:
+		case <-t.Chan():
+			opts.slept(delay, opts.clock.Now().Sub(sleepStart))
 			continue
 		}
+		if !t.Stop() {
+			// the timer fired as the context was cancelled, so drain it
+			// before it is reset. Depending on the timer implementation,
+			// the value may never arrive, so don't wait for it.
+			select {
+			case <-t.Chan():
+			default:
+			}
+		}
+		opts.slept(delay, opts.clock.Now().Sub(sleepStart))
+		if ctx.Err() != nil {
+			opts.explainf("stop: context done during delay")
+			return ctxDone(status)
+		}
+		opts.explainf("stop: OnShutdown during delay")
+		return shuttingDown(lastErr)
+	}
+}
+
+// estimateTries returns the number of tries that will fit in the given time,
+// assuming that every delay is the median for its step and that the tries
+// themselves take no time.
+func estimateTries(remaining time.Duration, opts *opts) int {
+	delays := opts.newBackoff(backoff.Median())
+	tries := 1
+	for total := delays(); total <= remaining; total += delays() {
+		tries++
+		if total < 0 || tries == math.MaxInt {
+			break
+		}
+	}
+	return tries
+}
+
+// waitPaused blocks while the retrier for the run is paused, or until the
+// context is cancelled.
+func waitPaused(ctx context.Context, opts *opts) error {
+	if opts.retrier == nil {
+		return nil
+	}
+	for resumed := opts.retrier.pausedCh(); resumed != nil; resumed = opts.retrier.pausedCh() {
+		select {
+		case <-ctx.Done():
+			opts.explainf("stop: context done while paused")
+			return opts.ctxErr(ctx)
+		case <-resumed:
+		}
+	}
+	return nil
+}
+
+// waitWindow blocks until the configured attempt window is open or the context
+// is cancelled.
+func waitWindow(ctx context.Context, opts *opts) error {
+	if opts.windowFn == nil {
+		return nil
+	}
+	for !opts.windowFn(opts.clock.Now()) {
+		select {
+		case <-ctx.Done():
+			opts.explainf("stop: context done outside Window")
+			return opts.ctxErr(ctx)
+		case <-opts.clock.After(WindowPollInterval):
+		}
+	}
+	return nil
+}
+
+// waitOnline blocks, backing off, until the configured connectivity check
+// reports that the network is available, the offline timeout is reached, or the
+// context is cancelled.
+func waitOnline(ctx context.Context, opts *opts) error {
+	if opts.onlineFn == nil || opts.onlineFn() {
+		return nil
+	}
+	offlineSince := opts.clock.Now()
+	delays := backoff.New(opts.initialDelay, opts.maxDelay, false, backoff.WithRand(opts.rnd))
+	for {
+		delay := delays()
+		if opts.offlineTimeout > 0 {
+			remaining := opts.offlineTimeout - opts.clock.Now().Sub(offlineSince)
+			if remaining <= 0 {
+				opts.explainf("stop: SkipIfOffline: still offline after %v", opts.offlineTimeout)
+				return Halt(ErrOffline)
+			}
+			delay = min(delay, remaining)
+		}
+		select {
+		case <-ctx.Done():
+			opts.explainf("stop: context done while offline")
+			return opts.ctxErr(ctx)
+		case <-opts.clock.After(delay):
+		}
+		if opts.onlineFn() {
+			return nil
+		}
 	}
 }
 
@@ -228,20 +710,75 @@ func FnOutCtx[OUT any](
 	options ...Option,
 ) (OUT, error) {
 	var (
-		zero  OUT
 		val   OUT
 		fnErr error
+		final finalResult
 	)
 	err := FnCtx(ctx, func(ctx context.Context) error {
 		val, fnErr = fn(ctx)
 		return fnErr
-	}, options...)
+	}, withFinal(options, &final)...)
 	if err != nil {
-		return zero, err
+		return haltValue[OUT](err), err
+	}
+	if final.ok {
+		// val is from the failed try before the final attempt.
+		return finalValue[OUT](&final)
 	}
 	return val, nil
 }
 
+// FnOutCtxOr works like [FnOutCtx], but if the run is exhausted, it returns
+// fallback and a nil error instead, for callers that would rather degrade
+// gracefully to a default than fail. The exhausted error is swallowed, although
+// each failure can still be seen with [Each]. Runs that end for any other
+// reason, such as a halt or cancellation, return the zero value and the error
+// as usual, since those are not failures to be papered over.
+func FnOutCtxOr[OUT any](
+	ctx context.Context,
+	fn func(context.Context) (OUT, error),
+	fallback OUT,
+	options ...Option,
+) (OUT, error) {
+	val, err := FnOutCtx(ctx, fn, options...)
+	if Exhausted(err) {
+		return fallback, nil
+	}
+	return val, err
+}
+
+// FnOut2Ctx is a retrier for functions with the signature of:
+//
+//	func(context.Context) (A, B, error)
+//
+// Where A and B are return values of any type. It saves having to bundle both
+// values into a struct to use [FnOutCtx].
+//
+// The function will be retried following the rules described in the package
+// documentation, and will return the values of the first successful run, or
+// zero values and the error of the final unsuccessful run.
+func FnOut2Ctx[A, B any](
+	ctx context.Context,
+	fn func(context.Context) (A, B, error),
+	options ...Option,
+) (A, B, error) {
+	var (
+		zeroA A
+		zeroB B
+		valA  A
+		valB  B
+		fnErr error
+	)
+	err := FnCtx(ctx, func(ctx context.Context) error {
+		valA, valB, fnErr = fn(ctx)
+		return fnErr
+	}, options...)
+	if err != nil {
+		return zeroA, zeroB, err
+	}
+	return valA, valB, nil
+}
+
 // FnInCtx is a retrier for functions with the signature of:
 //
 //	func(context.Context, IN) error
@@ -276,13 +813,38 @@ func FnInCtxRefr[IN any](
 	fnArg IN,
 	refreshFn RefreshFn[IN],
 	options ...Option,
+) error {
+	var refreshCtxFn RefreshCtxFn[IN]
+	if refreshFn != nil {
+		refreshCtxFn = func(context.Context) (IN, error) {
+			return refreshFn()
+		}
+	}
+	return FnInCtxRefrCtx(ctx, fn, fnArg, refreshCtxFn, options...)
+}
+
+// FnInCtxRefrCtx works like [FnInCtxRefr], but refreshFn is passed the context
+// of the try that failed, so that a refresh doing I/O can be cancelled along
+// with the run. If the context is done by the time refreshFn fails, the run
+// ends with the context's error, or its cause, rather than a [*RefreshError].
+func FnInCtxRefrCtx[IN any](
+	ctx context.Context,
+	fn func(context.Context, IN) error,
+	fnArg IN,
+	refreshFn RefreshCtxFn[IN],
+	options ...Option,
 ) error {
 	return FnCtx(ctx, func(ictx context.Context) error {
 		err := fn(ictx, fnArg)
 		if err != nil {
 			if refreshFn != nil {
-				nArg, refreshErr := refreshFn()
+				nArg, refreshErr := refreshFn(ictx)
 				if refreshErr != nil {
+					if ictx.Err() != nil {
+						// returned as is, so that the loop ends the run
+						// with the cancellation.
+						return ictx.Err()
+					}
 					return errRefresh(refreshErr, err)
 				}
 				fnArg = nArg
@@ -309,16 +871,20 @@ func FnIOCtx[IN, OUT any](
 	options ...Option,
 ) (OUT, error) {
 	var (
-		zero  OUT
 		val   OUT
 		fnErr error
+		final finalResult
 	)
 	err := FnInCtx(ctx, func(ictx context.Context, arg IN) error {
 		val, fnErr = fn(ictx, arg)
 		return fnErr
-	}, fnArg, options...)
+	}, fnArg, withFinal(options, &final)...)
 	if err != nil {
-		return zero, err
+		return haltValue[OUT](err), err
+	}
+	if final.ok {
+		// val is from the failed try before the final attempt.
+		return finalValue[OUT](&final)
 	}
 	return val, nil
 }
@@ -339,26 +905,76 @@ func FnIOCtxRefr[IN, OUT any](
 	options ...Option,
 ) (OUT, error) {
 	var (
-		zero  OUT
 		val   OUT
 		fnErr error
+		final finalResult
 	)
 	err := FnInCtxRefr(ctx, func(ictx context.Context, arg IN) error {
 		val, fnErr = fn(ictx, arg)
 		return fnErr
-	}, fnArg, refreshFn, options...)
+	}, fnArg, refreshFn, withFinal(options, &final)...)
 	if err != nil {
-		return zero, err
+		return haltValue[OUT](err), err
+	}
+	if final.ok {
+		// val is from the failed try before the final attempt.
+		return finalValue[OUT](&final)
 	}
 	return val, nil
 }
 
+// FnIOCtxRefrCtx works like [FnIOCtxRefr], but refreshFn is passed the context
+// of the try that failed, as with [FnInCtxRefrCtx].
+func FnIOCtxRefrCtx[IN, OUT any](
+	ctx context.Context,
+	fn func(context.Context, IN) (OUT, error),
+	fnArg IN,
+	refreshFn RefreshCtxFn[IN],
+	options ...Option,
+) (OUT, error) {
+	var (
+		val   OUT
+		fnErr error
+		final finalResult
+	)
+	err := FnInCtxRefrCtx(ctx, func(ictx context.Context, arg IN) error {
+		val, fnErr = fn(ictx, arg)
+		return fnErr
+	}, fnArg, refreshFn, withFinal(options, &final)...)
+	if err != nil {
+		return haltValue[OUT](err), err
+	}
+	if final.ok {
+		// val is from the failed try before the final attempt.
+		return finalValue[OUT](&final)
+	}
+	return val, nil
+}
+
+// CloneArg wraps fn so that each call is passed a fresh copy of its argument,
+// made using clone, for use with [FnInCtx], [FnInCtxRefr] and the like:
+//
+//	redo.FnInCtxRefr(ctx, redo.CloneArg(fn, cloneReq), req, refreshFn)
+//
+// This guarantees that every try starts from the same input, even if IN is a
+// pointer or holds maps or slices that a failed try may have modified. It is up
+// to clone to copy deeply enough for that to hold.
+func CloneArg[IN any](fn func(context.Context, IN) error, clone func(IN) IN) func(context.Context, IN) error {
+	return func(ctx context.Context, arg IN) error {
+		return fn(ctx, clone(arg))
+	}
+}
+
 // RefreshFn is a function that can be passed to any of the -Refresh retriers to
 // recreate or reset the input argument to the function between retries. If this
 // function returns an error, it will be wrapped in a [*RefreshError] value,
 // along with the underlying error that triggered the retry.
 type RefreshFn[T any] func() (T, error)
 
+// RefreshCtxFn is a [RefreshFn] that is passed the context of the try that
+// failed, for use with the -RefrCtx retriers.
+type RefreshCtxFn[T any] func(context.Context) (T, error)
+
 // Halted returns true if the retry was manually halted by the user by returning.
 // an error wrapped with [Halt]
 func Halted(e error) bool {
@@ -373,5 +989,60 @@ func Halted(e error) bool {
 //
 // To stop the retry run immediately.
 func Halt(e error) *haltErr {
-	return &haltErr{e}
+	return &haltErr{err: e}
+}
+
+// HaltValue works like [Halt], but also carries a value for the retriers that
+// return one, such as [FnOutCtx] and [FnIOCtx], to return in place of the zero
+// value when the run halts, for a function that has something meaningful to
+// return even though it cannot go on:
+//
+//	return nil, redo.HaltValue(partial, err)
+//
+// The value is only returned if its type matches the retrier's OUT type
+// exactly, and the value the function returned alongside the error is
+// ignored. It has no effect on the other retriers, including [FnOut2Ctx], and
+// on an error returned with [FnCtx] or the like, the value can only be reached
+// with [HaltedValue].
+func HaltValue[OUT any](val OUT, e error) *haltErr {
+	return &haltErr{err: e, value: val, hasValue: true}
+}
+
+// HaltedValue returns the value recorded with [HaltValue], if err or any error
+// it wraps was created with it and the value is of type OUT.
+func HaltedValue[OUT any](e error) (OUT, bool) {
+	var he *haltErr
+	if errors.As(e, &he) && he.hasValue {
+		v, ok := he.value.(OUT)
+		return v, ok
+	}
+	var zero OUT
+	return zero, false
+}
+
+// haltValue returns the value recorded with HaltValue, if any, or the zero
+// value of OUT.
+func haltValue[OUT any](e error) OUT {
+	v, _ := HaltedValue[OUT](e)
+	return v
+}
+
+// HaltRetryAfter works like [Halt], but also records a hint for the caller as
+// to how long it should wait before trying the whole operation again, such as
+// the Retry-After header of an HTTP 429 response. The hint does not affect the
+// current run, which halts immediately, but can be retrieved from the error it
+// returns using [RetryAfterHint].
+func HaltRetryAfter(e error, after time.Duration) *haltErr {
+	return &haltErr{err: e, retryAfter: after, hasHint: true}
+}
+
+// RetryAfter allows you to return an error from within the retry loop that
+// asks for the next try to wait at least after, such as for a server that says
+// when it will be ready again, without halting the run. The delay is only ever
+// lengthened, it is not capped by [MaxDelay], and it is reported in
+// [Status].NextDelay and still counts against [MaxElapsed]. It can also be
+// retrieved from the error the run ends with using [RetryAfterHint]. It should
+// not be used to wrap an error from [Halt].
+func RetryAfter(e error, after time.Duration) error {
+	return &retryAfterErr{err: e, after: after}
 }
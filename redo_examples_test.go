@@ -21,7 +21,7 @@ func maybeAFatalError() error {
 	return fmt.Errorf("temporary failure")
 }
 
-func ExampleHaltOn() {
+func ExampleHaltFn() {
 	haltFn := func(err error) bool {
 		return errors.Is(err, ErrIDontLike)
 	}
@@ -0,0 +1,722 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only advances when something waits on it.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// NewTimer returns a timer that fires as soon as it is reset, advancing the
+// clock by its duration.
+func (c *fakeClock) NewTimer(time.Duration) timer {
+	return &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	c     chan time.Time
+}
+
+func (t *fakeTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	select {
+	case t.c <- <-t.clock.After(d):
+	default:
+		panic("fakeTimer reset without draining")
+	}
+	return false
+}
+
+func (t *fakeTimer) Stop() bool {
+	return false
+}
+
+func withClock(c clock) Option {
+	return func(o *opts) {
+		o.clock = c
+	}
+}
+
+func TestWindow(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := newFakeClock(day.Add(7*time.Hour + 30*time.Minute))
+	businessHours := func(t time.Time) bool {
+		return t.Hour() >= 9 && t.Hour() < 17
+	}
+	var attempts []time.Time
+	err := FnCtx(context.Background(), func(context.Context) error {
+		now := clk.Now()
+		attempts = append(attempts, now)
+		if len(attempts) == 1 {
+			// close the window before the next attempt
+			clk.Set(day.Add(17 * time.Hour))
+			return errors.New("fail")
+		}
+		return nil
+	}, Window(businessHours), InitialDelay(time.Millisecond), withClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		day.Add(9 * time.Hour),
+		day.Add(33 * time.Hour),
+	}
+	if len(attempts) != len(want) {
+		t.Fatalf("got %d attempts, want %d", len(attempts), len(want))
+	}
+	for i := range want {
+		// the fake clock also advances by the delay between tries, so only
+		// the window polling granularity matters.
+		if !attempts[i].Truncate(WindowPollInterval).Equal(want[i]) {
+			t.Errorf("attempt %d at %v, want %v", i+1, attempts[i], want[i])
+		}
+	}
+}
+
+func TestWindowCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	errStop := errors.New("stop")
+	cancel(errStop)
+	err := FnCtx(ctx, func(context.Context) error {
+		t.Fatal("attempted outside of window")
+		return nil
+	}, Window(func(time.Time) bool { return false }), withClock(newFakeClock(time.Time{})))
+	if !errors.Is(err, errStop) {
+		t.Fatalf("got %v, want %v", err, errStop)
+	}
+}
+
+func TestOnSleepDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var planned, actual []time.Duration
+	_ = FnCtx(ctx, func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Hour),
+		OnSleep(func(p, a time.Duration) {
+			planned = append(planned, p)
+			actual = append(actual, a)
+		}),
+	)
+	if len(planned) != 1 {
+		t.Fatalf("got %d sleeps, want 1", len(planned))
+	}
+	if actual[0] >= planned[0] {
+		t.Fatalf("actual sleep %v not shorter than planned %v", actual[0], planned[0])
+	}
+	if actual[0] < 50*time.Millisecond {
+		t.Fatalf("actual sleep %v shorter than the deadline", actual[0])
+	}
+}
+
+func TestSkipIfOffline(t *testing.T) {
+	clk := newFakeClock(time.Time{})
+	// offline for the first three checks before the first try, and one before
+	// the second.
+	checks := []bool{false, false, false, true, false, true}
+	online := func() bool {
+		ok := checks[0]
+		checks = checks[1:]
+		return ok
+	}
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(2),
+		SkipIfOffline(online, 0),
+		withClock(clk),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("expected exhausted error, got %v", err)
+	}
+	if tries != 2 {
+		t.Fatalf("got %d tries, want 2", tries)
+	}
+	if len(checks) != 0 {
+		t.Fatalf("%d connectivity checks left over", len(checks))
+	}
+}
+
+func TestSkipIfOfflineTimeout(t *testing.T) {
+	clk := newFakeClock(time.Time{})
+	err := FnCtx(context.Background(), func(context.Context) error {
+		t.Fatal("attempted while offline")
+		return nil
+	},
+		SkipIfOffline(func() bool { return false }, time.Hour),
+		withClock(clk),
+	)
+	if !Halted(err) || !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected halted ErrOffline, got %v", err)
+	}
+	if waited := clk.Now().Sub(time.Time{}); waited != time.Hour {
+		t.Fatalf("waited %v, want %v", waited, time.Hour)
+	}
+}
+
+func TestFinalAttempt(t *testing.T) {
+	errFail := errors.New("fail")
+	var made, finals int
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errFail
+	},
+		NoDelay(),
+		MaxTries(3),
+		Attempts(&made),
+		FinalAttempt(func(ctx context.Context) error {
+			finals++
+			if GetStatus(ctx).TryNumber != 3 {
+				t.Errorf("final attempt got status %v, want that of try 3", GetStatus(ctx))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("got %v, want success from the final attempt", err)
+	}
+	if finals != 1 || made != 4 {
+		t.Fatalf("got %d final attempts and %d tries, want 1 and 4", finals, made)
+	}
+
+	finals = 0
+	err = FnCtx(context.Background(), func(context.Context) error {
+		return errFail
+	}, NoDelay(), MaxTries(2), FinalAttempt(func(context.Context) error {
+		finals++
+		return errors.New("still failing")
+	}))
+	if !Exhausted(err) || !errors.Is(err, errFail) || finals != 1 {
+		t.Fatalf("got %v after %d final attempts, want exhausted with the last error", err, finals)
+	}
+
+	// the retriers that return a value return that of the final attempt.
+	failing := func(context.Context) (string, error) { return "failed try", errFail }
+	out, err := FnOutCtx(context.Background(), failing, NoDelay(), MaxTries(2),
+		FinalAttemptOut(func(context.Context) (string, error) { return "final", nil }))
+	if err != nil || out != "final" {
+		t.Fatalf("got %q, %v; want the final attempt's value", out, err)
+	}
+	// or report that there is none, rather than pass off a zero value.
+	out, err = FnOutCtx(context.Background(), failing, NoDelay(), MaxTries(2),
+		FinalAttempt(func(context.Context) error { return nil }))
+	if !errors.Is(err, ErrNoFinalValue) || out != "" {
+		t.Fatalf("got %q, %v; want the zero value and %v", out, err, ErrNoFinalValue)
+	}
+	out, err = FnOutCtx(context.Background(), failing, NoDelay(), MaxTries(2),
+		FinalAttemptOut(func(context.Context) (int, error) { return 1, nil }))
+	if !errors.Is(err, ErrNoFinalValue) || out != "" {
+		t.Fatalf("got %q, %v; want the zero value and %v for a value of the wrong type", out, err, ErrNoFinalValue)
+	}
+
+	// halted runs give up at once.
+	finals = 0
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		return Halt(errFail)
+	}, FinalAttempt(func(context.Context) error {
+		finals++
+		return nil
+	}))
+	if finals != 0 {
+		t.Fatal("final attempt made after a halt")
+	}
+}
+
+func TestLoadShed(t *testing.T) {
+	errFail := errors.New("fail")
+	var overloaded atomic.Bool
+	tries := 0
+	err := FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		if tries == 3 {
+			overloaded.Store(true)
+		}
+		return errFail
+	}, NoDelay(), MaxTries(10), LoadShed(overloaded.Load))
+	if !Halted(err) || !errors.Is(err, ErrLoadShed) || !errors.Is(err, errFail) {
+		t.Fatalf("got %v, want halted ErrLoadShed wrapping the last error", err)
+	}
+	if tries != 3 {
+		t.Fatalf("got %d tries, want 3", tries)
+	}
+}
+
+func TestLastDuration(t *testing.T) {
+	clk := newFakeClock(time.Time{})
+	var (
+		inside []time.Duration
+		after  []time.Duration
+	)
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		s := GetStatus(ctx)
+		inside = append(inside, s.LastDuration)
+		clk.Set(clk.Now().Add(time.Duration(s.TryNumber) * time.Second))
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(3),
+		withClock(clk),
+		Each(func(s Status) { after = append(after, s.LastDuration) }),
+	)
+	wantInside := []time.Duration{0, time.Second, 2 * time.Second}
+	wantAfter := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if fmt.Sprint(inside) != fmt.Sprint(wantInside) {
+		t.Errorf("inside tries got %v, want %v", inside, wantInside)
+	}
+	if fmt.Sprint(after) != fmt.Sprint(wantAfter) {
+		t.Errorf("after tries got %v, want %v", after, wantAfter)
+	}
+}
+
+func TestSlowAttemptThreshold(t *testing.T) {
+	clk := newFakeClock(time.Time{})
+	var slow []string
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		s := GetStatus(ctx)
+		clk.Set(clk.Now().Add(time.Duration(s.TryNumber) * time.Second))
+		if s.TryNumber < 3 {
+			return errors.New("fail")
+		}
+		return nil
+	},
+		InitialDelay(time.Millisecond),
+		withClock(clk),
+		SlowAttemptThreshold(1500*time.Millisecond, func(s Status, d time.Duration) {
+			slow = append(slow, fmt.Sprintf("%d:%v", s.TryNumber, d))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("got %v, want success", err)
+	}
+	// fires for every slow call, including the one that succeeded.
+	if want := "[2:2s 3:3s]"; fmt.Sprint(slow) != want {
+		t.Fatalf("got slow calls %v, want %v", slow, want)
+	}
+}
+
+func TestExhaustedWithInnerDeadline(t *testing.T) {
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}, MaxTries(1))
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want it to wrap context.DeadlineExceeded", err)
+	}
+
+	// when the run's own context is done, cancellation still wins.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = FnCtx(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, MaxTries(1))
+	if Exhausted(err) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded, not exhausted", err)
+	}
+}
+
+func TestDeadlineCause(t *testing.T) {
+	errSLA := errors.New("SLA exceeded")
+	tests := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		// the function notices the deadline itself.
+		{"function", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		// the deadline passes while waiting between tries.
+		{"sleep", func(context.Context) error {
+			return errors.New("fail")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func(options ...Option) error {
+				ctx, cancel := context.WithTimeoutCause(context.Background(), 5*time.Millisecond, errSLA)
+				defer cancel()
+				return FnCtx(ctx, tt.fn, append([]Option{InitialDelay(time.Second)}, options...)...)
+			}
+			if err := run(); err != errSLA {
+				t.Errorf("got %v, want cause %v", err, errSLA)
+			}
+			if err := run(CtxCause(false)); err != context.DeadlineExceeded {
+				t.Errorf("got %v with CtxCause(false), want %v", err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestFnUntilCtxDone(t *testing.T) {
+	errFail := errors.New("fail")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tries := 0
+	err := FnUntilCtxDone(ctx, func(context.Context) error {
+		tries++
+		return errFail
+	}, InitialDelay(time.Millisecond), MaxDelay(5*time.Millisecond), MaxTries(2))
+	if !Exhausted(err) || !errors.Is(err, errFail) {
+		t.Fatalf("got %v, want exhausted %v", err, errFail)
+	}
+	// 50ms fits at least 10 tries at no more than 5ms apart.
+	if tries < 10 {
+		t.Fatalf("got %d tries, want MaxTries to be ignored until the deadline", tries)
+	}
+
+	// nor do the options that would otherwise choose MaxTries.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tries = 0
+	err = FnUntilCtxDone(ctx, func(context.Context) error {
+		tries++
+		return errFail
+	}, PolicyByError(func(error) Policy {
+		return Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxTries: 2}
+	}), BudgetFromFirstLatency(time.Millisecond))
+	if !Exhausted(err) || tries < 10 {
+		t.Fatalf("got %v after %d tries, want MaxTries to be ignored until the deadline", err, tries)
+	}
+
+	// the last failure is kept even if the final try is cut off by ctx.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	tries = 0
+	err = FnUntilCtxDone(ctx, func(ctx context.Context) error {
+		tries++
+		if tries < 3 {
+			return errFail
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, InitialDelay(time.Millisecond), MaxDelay(time.Millisecond))
+	if !Exhausted(err) || !errors.Is(err, errFail) {
+		t.Fatalf("got %v, want exhausted %v", err, errFail)
+	}
+
+	// without any failures, the context error is returned as usual.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = FnUntilCtxDone(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if Exhausted(err) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCloneArg(t *testing.T) {
+	type request struct {
+		headers map[string]string
+	}
+	clone := func(r *request) *request {
+		return &request{headers: maps.Clone(r.headers)}
+	}
+	req := &request{headers: map[string]string{"a": "1"}}
+	tries := 0
+	err := FnInCtx(context.Background(), CloneArg(func(_ context.Context, r *request) error {
+		tries++
+		if len(r.headers) != 1 {
+			t.Errorf("try %d got headers %v, want the original", tries, r.headers)
+		}
+		// a failed try that mutates its input.
+		r.headers[fmt.Sprint(tries)] = "dirty"
+		if tries < 3 {
+			return errors.New("fail")
+		}
+		return nil
+	}, clone), req, NoDelay())
+	if err != nil || tries != 3 {
+		t.Fatalf("got %v after %d tries, want success after 3", err, tries)
+	}
+	if len(req.headers) != 1 {
+		t.Fatalf("got headers %v, want the original to be untouched", req.headers)
+	}
+}
+
+func TestFnOutCtxOr(t *testing.T) {
+	errFail := errors.New("fail")
+	val, err := FnOutCtxOr(context.Background(), func(context.Context) (string, error) {
+		return "partial", errFail
+	}, "default", NoDelay(), MaxTries(3))
+	if val != "default" || err != nil {
+		t.Fatalf("got %q, %v; want the fallback after exhaustion", val, err)
+	}
+
+	val, err = FnOutCtxOr(context.Background(), func(context.Context) (string, error) {
+		return "live", nil
+	}, "default")
+	if val != "live" || err != nil {
+		t.Fatalf("got %q, %v; want the live value", val, err)
+	}
+
+	// halts are not papered over.
+	val, err = FnOutCtxOr(context.Background(), func(context.Context) (string, error) {
+		return "", Halt(errFail)
+	}, "default")
+	if val != "" || !Halted(err) {
+		t.Fatalf("got %q, %v; want a halted error", val, err)
+	}
+}
+
+func TestFnOut2Ctx(t *testing.T) {
+	tries := 0
+	name, age, err := FnOut2Ctx(context.Background(), func(context.Context) (string, int, error) {
+		tries++
+		if tries < 2 {
+			return "partial", 1, errors.New("fail")
+		}
+		return "gopher", 14, nil
+	}, InitialDelay(time.Millisecond))
+	if err != nil || name != "gopher" || age != 14 {
+		t.Fatalf("got %q, %d, %v; want %q, %d, nil", name, age, err, "gopher", 14)
+	}
+
+	name, age, err = FnOut2Ctx(context.Background(), func(context.Context) (string, int, error) {
+		return "partial", 1, errors.New("fail")
+	}, InitialDelay(time.Millisecond), MaxTries(2))
+	if !Exhausted(err) || name != "" || age != 0 {
+		t.Fatalf("got %q, %d, %v; want zero values and exhausted", name, age, err)
+	}
+}
+
+func TestTimerReuse(t *testing.T) {
+	const tries = 300
+	var sleeps int
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxDelay(time.Millisecond),
+		MaxTries(tries),
+		OnSleep(func(planned, actual time.Duration) {
+			sleeps++
+			if actual < planned {
+				t.Errorf("sleep %d woke early: slept %v of %v", sleeps, actual, planned)
+			}
+		}),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if sleeps != tries-1 {
+		t.Fatalf("got %d sleeps, want %d", sleeps, tries-1)
+	}
+}
+
+func TestTimerReuseCancelled(t *testing.T) {
+	// cancel at various points relative to the timer firing, to exercise the
+	// race between the two.
+	for i := range 100 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%4)*500*time.Microsecond)
+		done := make(chan error, 1)
+		go func() {
+			done <- FnCtx(ctx, func(context.Context) error {
+				return errors.New("fail")
+			}, InitialDelay(time.Millisecond), MaxDelay(time.Millisecond), MaxTries(-1))
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("run %d: got %v, want context.DeadlineExceeded", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d: did not return after cancellation", i)
+		}
+		cancel()
+	}
+}
+
+func TestTimerReuseFakeClock(t *testing.T) {
+	const tries = 1000
+	clk := newFakeClock(time.Time{})
+	var planned time.Duration
+	err := FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	},
+		InitialDelay(time.Second),
+		MaxDelay(time.Minute),
+		MaxTries(tries),
+		withClock(clk),
+		OnSleep(func(p, actual time.Duration) {
+			planned += p
+			if actual != p {
+				t.Fatalf("slept %v, planned %v", actual, p)
+			}
+		}),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if elapsed := clk.Now().Sub(time.Time{}); elapsed != planned {
+		t.Fatalf("clock advanced %v, want %v", elapsed, planned)
+	}
+}
+
+func TestBudgetFromFirstLatency(t *testing.T) {
+	run := func(latency time.Duration) (tries int, maxTries []int) {
+		clk := newFakeClock(time.Time{})
+		_ = FnCtx(context.Background(), func(context.Context) error {
+			tries++
+			clk.Set(clk.Now().Add(latency))
+			return errors.New("fail")
+		},
+			InitialDelay(time.Millisecond),
+			MaxTries(10),
+			withClock(clk),
+			BudgetFromFirstLatency(time.Second),
+			Each(func(s Status) { maxTries = append(maxTries, s.MaxTries) }),
+		)
+		return tries, maxTries
+	}
+	if tries, _ := run(time.Millisecond); tries != 10 {
+		t.Fatalf("got %d tries for a fast function, want the full 10", tries)
+	}
+	// 300ms a try leaves room for 3 tries in 1s.
+	tries, maxTries := run(300 * time.Millisecond)
+	if tries != 3 {
+		t.Fatalf("got %d tries for a slow function, want 3", tries)
+	}
+	if maxTries[0] != 3 {
+		t.Fatalf("got MaxTries %v in the status, want 3 from the first try", maxTries)
+	}
+
+	// a resumed run counts the budget from the try it started at.
+	var tries2 []int
+	clk := newFakeClock(time.Time{})
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		tries2 = append(tries2, GetStatus(ctx).TryNumber)
+		clk.Set(clk.Now().Add(300 * time.Millisecond))
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		MaxTries(10),
+		StartAttempt(5),
+		withClock(clk),
+		BudgetFromFirstLatency(time.Second),
+	)
+	if fmt.Sprint(tries2) != "[5 6 7]" {
+		t.Fatalf("got tries %v after StartAttempt(5), want [5 6 7]", tries2)
+	}
+
+	// a policy chosen later cannot raise the budgeted limit.
+	tries = 0
+	clk = newFakeClock(time.Time{})
+	_ = FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		clk.Set(clk.Now().Add(300 * time.Millisecond))
+		return errors.New("fail")
+	},
+		InitialDelay(time.Millisecond),
+		withClock(clk),
+		BudgetFromFirstLatency(time.Second),
+		PolicyByError(func(error) Policy { return Policy{MaxTries: 20} }),
+	)
+	if tries != 3 {
+		t.Fatalf("got %d tries with PolicyByError, want the budgeted 3", tries)
+	}
+}
+
+func TestOnShutdown(t *testing.T) {
+	errFail := errors.New("fail")
+
+	// during a try, which is left to finish.
+	shutdown := make(chan struct{})
+	tries := 0
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		tries++
+		close(shutdown)
+		if ctx.Err() != nil {
+			t.Error("try interrupted by shutdown")
+		}
+		return errFail
+	}, NoDelay(), OnShutdown(shutdown))
+	if !Halted(err) || !errors.Is(err, ErrShuttingDown) || !errors.Is(err, errFail) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want halted ErrShuttingDown after 1", err, tries)
+	}
+
+	// a try that succeeds while shutting down still succeeds.
+	shutdown = make(chan struct{})
+	err = FnCtx(context.Background(), func(context.Context) error {
+		close(shutdown)
+		return nil
+	}, OnShutdown(shutdown))
+	if err != nil {
+		t.Fatalf("got %v, want success", err)
+	}
+
+	// during a delay, which is cut short.
+	shutdown = make(chan struct{})
+	tries = 0
+	start := time.Now()
+	err = FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		return errFail
+	}, InitialDelay(time.Hour), OnShutdown(shutdown), Each(func(Status) {
+		time.AfterFunc(10*time.Millisecond, func() { close(shutdown) })
+	}))
+	if !errors.Is(err, ErrShuttingDown) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want ErrShuttingDown after 1", err, tries)
+	}
+	if waited := time.Since(start); waited > time.Minute {
+		t.Fatalf("waited %v for the delay", waited)
+	}
+
+	// no try is started once shut down.
+	err = FnCtx(context.Background(), func(context.Context) error {
+		t.Fatal("try started after shutdown")
+		return nil
+	}, OnShutdown(shutdown))
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("got %v, want ErrShuttingDown", err)
+	}
+}
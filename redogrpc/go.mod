@@ -0,0 +1,14 @@
+module andy.dev/redo/redogrpc
+
+go 1.23.0
+
+require (
+	andy.dev/redo v0.0.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7
+	google.golang.org/grpc v1.75.1
+	google.golang.org/protobuf v1.36.11
+)
+
+require golang.org/x/sys v0.35.0 // indirect
+
+replace andy.dev/redo => ../
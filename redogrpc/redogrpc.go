@@ -0,0 +1,77 @@
+// Package redogrpc provides helpers for retrying gRPC calls with redo. It is a
+// separate module so that the core redo module does not depend on gRPC.
+package redogrpc
+
+import (
+	"time"
+
+	"andy.dev/redo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRetryableCodes are the codes considered retryable by
+// [RetryableCodes] when it is called without any codes.
+var DefaultRetryableCodes = []codes.Code{
+	codes.Unavailable,
+	codes.ResourceExhausted,
+	codes.Aborted,
+}
+
+// RetryableCodes returns a function for use with [redo.HaltFn] that halts the
+// run when a call fails with a gRPC status whose code is not one of codes, so
+// that only the given codes are retried. If no codes are given,
+// [DefaultRetryableCodes] are used.
+//
+// Errors that do not carry a gRPC status, such as those returned before a call
+// is made, never halt the run.
+//
+//	err := redo.FnCtx(ctx, call,
+//	    redo.HaltFn(redogrpc.RetryableCodes()),
+//	    redo.MapError(redogrpc.HonorRetryInfo),
+//	)
+func RetryableCodes(retryable ...codes.Code) func(error) bool {
+	if len(retryable) == 0 {
+		retryable = DefaultRetryableCodes
+	}
+	set := make(map[codes.Code]bool, len(retryable))
+	for _, c := range retryable {
+		set[c] = true
+	}
+	return func(err error) bool {
+		s, ok := status.FromError(err)
+		if !ok {
+			return false
+		}
+		return !set[s.Code()]
+	}
+}
+
+// RetryDelay returns the retry delay from the RetryInfo details of err's gRPC
+// status, which servers send to say how long to wait before trying again, such
+// as with ResourceExhausted. It returns false if err does not carry a gRPC
+// status with a valid RetryInfo.
+func RetryDelay(err error) (time.Duration, bool) {
+	s, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.GetRetryDelay().IsValid() {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// HonorRetryInfo is a function for use with [redo.MapError] that makes the run
+// wait at least as long as the server asked in the RetryInfo details of a
+// failed call's status, as found by [RetryDelay], before the next try. Errors
+// without RetryInfo are returned as they are.
+func HonorRetryInfo(err error) error {
+	if d, ok := RetryDelay(err); ok {
+		return redo.RetryAfter(err, d)
+	}
+	return err
+}
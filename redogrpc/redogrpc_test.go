@@ -0,0 +1,104 @@
+package redogrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"andy.dev/redo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestRetryableCodes(t *testing.T) {
+	haltFn := RetryableCodes()
+	tests := []struct {
+		err  error
+		halt bool
+	}{
+		{status.Error(codes.Unavailable, "down"), false},
+		{status.Error(codes.ResourceExhausted, "slow down"), false},
+		{status.Error(codes.Aborted, "conflict"), false},
+		{status.Error(codes.InvalidArgument, "bad"), true},
+		{status.Error(codes.NotFound, "missing"), true},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.NotFound, "missing")), true},
+		{errors.New("not a status"), false},
+	}
+	for _, tt := range tests {
+		if got := haltFn(tt.err); got != tt.halt {
+			t.Errorf("halt(%v) = %v, want %v", tt.err, got, tt.halt)
+		}
+	}
+
+	if !RetryableCodes(codes.NotFound)(status.Error(codes.Unavailable, "down")) {
+		t.Error("expected explicit codes to replace the defaults")
+	}
+}
+
+func TestRetryableCodesHaltsRun(t *testing.T) {
+	tries := 0
+	err := redo.FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		if tries < 3 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return status.Error(codes.PermissionDenied, "no")
+	}, redo.InitialDelay(time.Millisecond), redo.HaltFn(RetryableCodes()))
+	if !redo.Halted(err) || status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected halt with PermissionDenied, got %v", err)
+	}
+	if tries != 3 {
+		t.Fatalf("got %d tries, want 3", tries)
+	}
+}
+
+func exhaustedWithRetryInfo(t *testing.T, delay time.Duration) error {
+	t.Helper()
+	s, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Err()
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d, ok := RetryDelay(exhaustedWithRetryInfo(t, 3*time.Second)); !ok || d != 3*time.Second {
+		t.Fatalf("got %v, %v; want 3s, true", d, ok)
+	}
+	if _, ok := RetryDelay(status.Error(codes.ResourceExhausted, "slow down")); ok {
+		t.Fatal("got a delay from a status without RetryInfo")
+	}
+	if _, ok := RetryDelay(errors.New("not a status")); ok {
+		t.Fatal("got a delay from a non-status error")
+	}
+}
+
+func TestHonorRetryInfo(t *testing.T) {
+	var delays []time.Duration
+	tries := 0
+	err := redo.FnCtx(context.Background(), func(context.Context) error {
+		tries++
+		if tries == 1 {
+			return exhaustedWithRetryInfo(t, 20*time.Millisecond)
+		}
+		return nil
+	},
+		redo.InitialDelay(time.Millisecond),
+		redo.MaxDelay(time.Millisecond),
+		redo.HaltFn(RetryableCodes()),
+		redo.MapError(HonorRetryInfo),
+		redo.Each(func(s redo.Status) { delays = append(delays, s.NextDelay) }),
+	)
+	if err != nil || tries != 2 {
+		t.Fatalf("got %v after %d tries, want success after 2", err, tries)
+	}
+	if delays[0] != 20*time.Millisecond {
+		t.Fatalf("got delay %v, want the 20ms from RetryInfo", delays[0])
+	}
+}
@@ -0,0 +1,137 @@
+// Package redohttp provides helpers for retrying HTTP requests with redo.
+package redohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"andy.dev/redo"
+)
+
+// DefaultRetryableStatuses are the response status codes retried by [Do].
+var DefaultRetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// ErrBodyNotReplayable is returned, wrapped in a halt, by [Do] when a try of a
+// request with a body fails, but the body cannot be sent again because the
+// request's GetBody is nil.
+var ErrBodyNotReplayable = errors.New("redohttp: request body cannot be replayed")
+
+// StatusError is the error for a try that got a response with one of the
+// [DefaultRetryableStatuses].
+type StatusError struct {
+	// StatusCode is the response's status code, such as 503.
+	StatusCode int
+	// Status is the response's status line, such as "503 Service Unavailable".
+	Status string
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	if e.Status == "" {
+		return "redohttp: status " + strconv.Itoa(e.StatusCode)
+	}
+	return "redohttp: " + e.Status
+}
+
+// Do sends req with client, retrying it with the given options when the
+// request fails or the response has one of the [DefaultRetryableStatuses]. Any
+// other response, including other error statuses, is returned as is, for the
+// caller to handle. If client is nil, [http.DefaultClient] is used.
+//
+// The body of each response that is retried is read and closed, so that the
+// connection can be reused. If the run ends without a response to return, the
+// error is a [*StatusError] for the last retryable status received, or the
+// error from the last try.
+//
+// Since sending a request consumes its body, the body is restored for each try
+// after the first using req.GetBody, which [http.NewRequest] sets for bodies
+// read from memory, such as a [*bytes.Reader] or [*strings.Reader]. A request
+// whose body is streamed from elsewhere has no GetBody, and cannot be retried,
+// so a failure of its first try halts the run with [ErrBodyNotReplayable],
+// wrapping the try's error.
+//
+// Errors from the client that retrying cannot fix, such as an unsupported URL
+// scheme, a malformed URL or a failed TLS handshake, halt the run. Timeouts,
+// temporary errors, failures to connect and connections closed early are
+// retried. This includes timeouts set on the client itself, the errors for
+// which do not match [context.DeadlineExceeded], so that they are not taken as
+// ctx being done.
+//
+//	resp, err := redohttp.Do(ctx, client, req, redo.MaxTries(5))
+func Do(ctx context.Context, client *http.Client, req *http.Request, options ...redo.Option) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	first := true
+	return redo.FnOutCtx(ctx, func(ctx context.Context) (*http.Response, error) {
+		r := req.Clone(ctx)
+		if hasBody && !first {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, redo.Halt(err)
+			}
+			r.Body = body
+		}
+		first = false
+		resp, err := client.Do(r)
+		if err == nil && slices.Contains(DefaultRetryableStatuses, resp.StatusCode) {
+			err = &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+			// drain the body so that the connection can be reused.
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			resp = nil
+		}
+		var ue *url.Error
+		if err != nil && ctx.Err() == nil && errors.As(err, &ue) && ue.Timeout() {
+			err = &url.Error{Op: ue.Op, URL: ue.URL, Err: clientTimeout{ue.Err}}
+		}
+		if err != nil && resp == nil && ctx.Err() == nil && !transient(err) {
+			return nil, redo.Halt(err)
+		}
+		if err != nil && hasBody && req.GetBody == nil && ctx.Err() == nil {
+			return nil, redo.Halt(errors.Join(ErrBodyNotReplayable, err))
+		}
+		return resp, err
+	}, options...)
+}
+
+// clientTimeout is the error from a try that hit the client's own timeout,
+// rather than the deadline of the run's context. It hides the context error it
+// replaces, which would otherwise end the run.
+type clientTimeout struct{ err error }
+
+func (e clientTimeout) Error() string { return e.err.Error() }
+
+func (e clientTimeout) Timeout() bool { return true }
+
+// transient reports whether an error from a try might not happen again, so that
+// it is worth retrying. Errors from the client are permanent unless they are a
+// timeout, temporary, from a connection or the connection closing early.
+func transient(err error) bool {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return true
+	}
+	if ue.Timeout() {
+		return true
+	}
+	var te interface{ Temporary() bool }
+	if errors.As(ue.Err, &te) && te.Temporary() {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(ue.Err, &oe) || errors.Is(ue.Err, io.EOF) || errors.Is(ue.Err, io.ErrUnexpectedEOF)
+}
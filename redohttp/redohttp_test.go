@@ -0,0 +1,126 @@
+package redohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"andy.dev/redo"
+)
+
+func TestDo(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "try again")
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Do(context.Background(), srv.Client(), req, redo.InitialDelay(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if string(b) != "ok" {
+		t.Fatalf("got response %q, want ok", b)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("got %d requests, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != "payload" {
+			t.Fatalf("request %d got body %q, want payload", i+1, body)
+		}
+	}
+}
+
+func TestDoStatuses(t *testing.T) {
+	var status int
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	// other statuses are returned as is.
+	status = http.StatusNotFound
+	resp, err := Do(context.Background(), nil, req, redo.NoDelay())
+	if err != nil || resp.StatusCode != http.StatusNotFound || n != 1 {
+		t.Fatalf("got %v after %d requests, want 404 after 1", err, n)
+	}
+	resp.Body.Close()
+
+	n = 0
+	status = http.StatusTooManyRequests
+	resp, err = Do(context.Background(), nil, req, redo.NoDelay(), redo.MaxTries(3))
+	var se *StatusError
+	if resp != nil || !redo.Exhausted(err) || !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests || n != 3 {
+		t.Fatalf("got %v after %d requests, want exhausted 429 after 3", err, n)
+	}
+}
+
+func TestDoStreamingBody(t *testing.T) {
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "stream")
+		pw.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, pr)
+	_, err := Do(context.Background(), nil, req, redo.NoDelay())
+	if !redo.Halted(err) || !errors.Is(err, ErrBodyNotReplayable) || n != 1 {
+		t.Fatalf("got %v after %d requests, want halted after 1", err, n)
+	}
+}
+
+func TestDoTransportErrors(t *testing.T) {
+	// an unsupported scheme cannot succeed on a later try.
+	var tries int
+	req, _ := http.NewRequest(http.MethodGet, "ftp://example.com/file", nil)
+	_, err := Do(context.Background(), nil, req, redo.NoDelay(), redo.MaxTries(3), redo.Attempts(&tries))
+	if !redo.Halted(err) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want halted after 1", err, tries)
+	}
+
+	// a timeout might not happen again, so it is retried.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	client := srv.Client()
+	client.Timeout = 10 * time.Millisecond
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	_, err = Do(context.Background(), client, req, redo.NoDelay(), redo.MaxTries(3), redo.Attempts(&tries))
+	var ne net.Error
+	if !redo.Exhausted(err) || !errors.As(err, &ne) || !ne.Timeout() || tries != 3 {
+		t.Fatalf("got %v after %d tries, want an exhausted timeout after 3", err, tries)
+	}
+}
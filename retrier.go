@@ -0,0 +1,186 @@
+package redo
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Retrier is a reusable retry configuration built from a [Policy], which can
+// also keep state across the runs made with it. Its methods can be used to
+// retry functions directly, or it can be passed to any retrier using
+// [WithRetrier].
+//
+// A Retrier is safe for concurrent use, but its exported fields must not be
+// changed after it is first used.
+type Retrier struct {
+	// FirstFastOnce makes the first retry immediate for only the first run
+	// made with the Retrier, rather than for every run, which is useful for a
+	// warm service where only the very first operation should retry quickly.
+	// The first run to start claims it, whether or not it ever retries, and
+	// concurrent runs will never both claim it. If set, it overrides the
+	// policy's FirstFast setting.
+	FirstFastOnce bool
+
+	policy        Policy
+	deadline      time.Time
+	firstFastUsed atomic.Bool
+
+	runs      atomic.Int64
+	attempts  atomic.Int64
+	successes atomic.Int64
+	giveUps   atomic.Int64
+	slept     atomic.Int64
+
+	histMu sync.Mutex
+	hist   map[int]int
+
+	pauseMu sync.Mutex
+	// closed and cleared by Resume, nil if not paused
+	resumed chan struct{}
+}
+
+// RetrierStats holds cumulative counters for all of the runs made with a
+// [*Retrier] since it was created. See [Retrier.Stats].
+type RetrierStats struct {
+	// Runs is the number of runs started.
+	Runs int64
+	// Attempts is the total number of calls to the functions being retried.
+	Attempts int64
+	// Successes is the number of runs that ended successfully.
+	Successes int64
+	// GiveUps is the number of runs that ended with an error, for any reason.
+	GiveUps int64
+	// Slept is the total time spent waiting between tries.
+	Slept time.Duration
+}
+
+// New returns a new [*Retrier] using the settings in p.
+func New(p Policy) *Retrier {
+	return &Retrier{policy: p}
+}
+
+// NewWithDeadline returns a new [*Retrier] using the settings in p, for a job
+// that must stop retrying at a fixed time whichever operation is running. Each
+// run made with it uses a context derived from the caller's with the given
+// deadline, so the earliest of the two deadlines wins. Runs started after the
+// deadline has passed return [context.DeadlineExceeded] without calling the
+// function.
+func NewWithDeadline(p Policy, deadline time.Time) *Retrier {
+	return &Retrier{policy: p, deadline: deadline}
+}
+
+// WithRetrier applies the policy and state of r to a run, allowing a
+// [*Retrier] to be used with any of the package-level retriers.
+func WithRetrier(r *Retrier) Option {
+	return func(o *opts) {
+		WithPolicy(r.policy)(o)
+		o.retrier = r
+	}
+}
+
+// Fn retries fn using the retrier's settings, as with the package-level [Fn].
+// Any options passed will override the retrier's policy.
+func (r *Retrier) Fn(ctx context.Context, fn func() error, options ...Option) error {
+	return Fn(ctx, fn, append([]Option{WithRetrier(r)}, options...)...)
+}
+
+// FnCtx retries fn using the retrier's settings, as with the package-level
+// [FnCtx]. Any options passed will override the retrier's policy.
+func (r *Retrier) FnCtx(ctx context.Context, fn func(context.Context) error, options ...Option) error {
+	return FnCtx(ctx, fn, append([]Option{WithRetrier(r)}, options...)...)
+}
+
+// Stats returns the cumulative counters for every run made with the retrier
+// since it was created. The counters only ever increase, and are updated
+// atomically as each run progresses, so runs still in progress will be
+// partially reflected.
+func (r *Retrier) Stats() RetrierStats {
+	return RetrierStats{
+		Runs:      r.runs.Load(),
+		Attempts:  r.attempts.Load(),
+		Successes: r.successes.Load(),
+		GiveUps:   r.giveUps.Load(),
+		Slept:     time.Duration(r.slept.Load()),
+	}
+}
+
+// Histogram returns the number of runs made with the retrier that needed each
+// number of calls to the function to succeed, so that, for instance, h[1] is
+// the number of runs that succeeded on their first try. Runs that ended with
+// an error, for any reason, are counted under 0. The returned map is a copy,
+// and it is safe to call concurrently with runs in progress, which will be
+// counted once they end.
+func (r *Retrier) Histogram() map[int]int {
+	r.histMu.Lock()
+	defer r.histMu.Unlock()
+	return maps.Clone(r.hist)
+}
+
+// Pause stops every run made with the retrier from making any more tries until
+// [Retrier.Resume] is called, such as during a maintenance window, without
+// ending the runs. A try already in progress is not interrupted, and runs wait
+// for the retrier to be resumed before each try, including the first, after
+// any delay. Their contexts still apply, so a cancelled context will end a
+// paused run. It is safe to call concurrently, and has no effect if the
+// retrier is already paused.
+func (r *Retrier) Pause() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	if r.resumed == nil {
+		r.resumed = make(chan struct{})
+	}
+}
+
+// Resume allows runs made with the retrier to carry on after [Retrier.Pause].
+// It is safe to call concurrently, and has no effect if the retrier is not
+// paused.
+func (r *Retrier) Resume() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	if r.resumed != nil {
+		close(r.resumed)
+		r.resumed = nil
+	}
+}
+
+// Paused returns true if the retrier has been paused with [Retrier.Pause] and
+// not yet resumed.
+func (r *Retrier) Paused() bool {
+	return r.pausedCh() != nil
+}
+
+// pausedCh returns a channel that will be closed when the retrier is resumed,
+// or nil if it is not paused.
+func (r *Retrier) pausedCh() <-chan struct{} {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	return r.resumed
+}
+
+// begin is called at the start of each run made with the retrier.
+func (r *Retrier) begin(o *opts) {
+	r.runs.Add(1)
+	if r.FirstFastOnce {
+		o.firstFast = r.firstFastUsed.CompareAndSwap(false, true)
+	}
+}
+
+// end is called with the final result of each run made with the retrier, and
+// the number of calls made to the function.
+func (r *Retrier) end(err error, attempts int) {
+	if err == nil {
+		r.successes.Add(1)
+	} else {
+		r.giveUps.Add(1)
+		attempts = 0
+	}
+	r.histMu.Lock()
+	defer r.histMu.Unlock()
+	if r.hist == nil {
+		r.hist = make(map[int]int)
+	}
+	r.hist[attempts]++
+}
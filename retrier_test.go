@@ -0,0 +1,211 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetrierFirstFastOnce(t *testing.T) {
+	r := New(Policy{InitialDelay: time.Millisecond})
+	r.FirstFastOnce = true
+	var firstDelays []time.Duration
+	for range 3 {
+		tries := 0
+		err := r.FnCtx(context.Background(), func(context.Context) error {
+			tries++
+			if tries == 1 {
+				return errors.New("fail")
+			}
+			return nil
+		}, Each(func(s Status) { firstDelays = append(firstDelays, s.NextDelay) }))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if firstDelays[0] != 0 {
+		t.Errorf("first run: got first delay %v, want 0", firstDelays[0])
+	}
+	for i, d := range firstDelays[1:] {
+		if d == 0 {
+			t.Errorf("run %d: got first delay 0, want backoff", i+2)
+		}
+	}
+}
+
+func TestRetrierStats(t *testing.T) {
+	const (
+		workers = 8
+		runs    = 10
+	)
+	r := New(Policy{InitialDelay: time.Microsecond, MaxTries: 2})
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range runs {
+				tries := 0
+				_ = r.FnCtx(context.Background(), func(context.Context) error {
+					tries++
+					// odd workers always fail, even workers succeed on the second try
+					if w%2 == 1 || tries == 1 {
+						return errors.New("fail")
+					}
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := r.Stats()
+	want := RetrierStats{
+		Runs:      workers * runs,
+		Attempts:  workers * runs * 2,
+		Successes: workers / 2 * runs,
+		GiveUps:   workers / 2 * runs,
+	}
+	slept := stats.Slept
+	stats.Slept = 0
+	if stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+	if slept <= 0 {
+		t.Fatalf("got slept %v, want > 0", slept)
+	}
+}
+
+func TestRetrierDeadline(t *testing.T) {
+	r := NewWithDeadline(Policy{InitialDelay: time.Millisecond, MaxTries: -1}, time.Now().Add(20*time.Millisecond))
+	err := r.FnCtx(context.Background(), func(context.Context) error {
+		return errors.New("fail")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the retrier's deadline to end the run", err)
+	}
+
+	// a call's own earlier deadline still applies.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	r = NewWithDeadline(Policy{InitialDelay: time.Millisecond, MaxTries: -1}, time.Now().Add(time.Hour))
+	start := time.Now()
+	err = r.FnCtx(ctx, func(context.Context) error {
+		return errors.New("fail")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Fatalf("got %v after %v, want the call's deadline to end the run", err, time.Since(start))
+	}
+
+	r = NewWithDeadline(Policy{}, time.Now().Add(-time.Second))
+	called := false
+	err = r.FnCtx(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if called || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v (called: %v), want calls after the deadline to fail fast", err, called)
+	}
+	// runs that fail fast still count as runs that gave up.
+	if got, want := r.Stats(), (RetrierStats{Runs: 1, GiveUps: 1}); got != want {
+		t.Fatalf("got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestRetrierHistogram(t *testing.T) {
+	const (
+		workers = 8
+		runs    = 10
+	)
+	r := New(Policy{InitialDelay: time.Microsecond, MaxTries: 3})
+	if h := r.Histogram(); len(h) != 0 {
+		t.Fatalf("got %v before any runs, want empty", h)
+	}
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range runs {
+				tries := 0
+				_ = r.FnCtx(context.Background(), func(context.Context) error {
+					tries++
+					// workers succeed on tries 1, 2 and 3, or never
+					if tries == w%4 {
+						return nil
+					}
+					return errors.New("fail")
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	h := r.Histogram()
+	want := map[int]int{0: 2 * runs, 1: 2 * runs, 2: 2 * runs, 3: 2 * runs}
+	if !maps.Equal(h, want) {
+		t.Fatalf("got histogram %v, want %v", h, want)
+	}
+	h[1] = 0
+	if r.Histogram()[1] != 2*runs {
+		t.Fatal("expected Histogram to return a copy")
+	}
+}
+
+func TestRetrierPause(t *testing.T) {
+	const gap = 20 * time.Millisecond
+	r := New(Policy{InitialDelay: time.Millisecond, MaxTries: -1})
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	paused := make(chan struct{})
+	done := Go(context.Background(), func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		switch len(times) {
+		case 2:
+			r.Pause()
+			close(paused)
+		case 4:
+			return nil
+		}
+		return errors.New("fail")
+	}, WithRetrier(r))
+
+	<-paused
+	time.Sleep(gap)
+	mu.Lock()
+	n := len(times)
+	mu.Unlock()
+	if n != 2 || !r.Paused() {
+		t.Fatalf("got %d tries while paused, want 2", n)
+	}
+	r.Resume()
+	r.Resume() // no effect if not paused
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want success after resuming", err)
+	}
+	if d := times[2].Sub(times[1]); d < gap {
+		t.Fatalf("got %v between tries across the pause, want at least %v", d, gap)
+	}
+
+	// a paused run still ends with its context.
+	r.Pause()
+	r.Pause() // no effect if already paused
+	defer r.Resume()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	called := false
+	err := r.FnCtx(ctx, func(context.Context) error {
+		called = true
+		return nil
+	})
+	if called || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v (called: %v), want the deadline to end the paused run", err, called)
+	}
+}
@@ -0,0 +1,202 @@
+// Package retrygo is a compatibility shim for moving code from
+// github.com/avast/retry-go to redo by changing only the import path. It
+// provides Do and the most used of that library's options, implemented on top
+// of redo:
+//
+//	err := retrygo.Do(
+//	    func() error { return fetch() },
+//	    retrygo.Attempts(5),
+//	    retrygo.OnRetry(func(n uint, err error) {
+//	        log.Printf("try #%d: %v", n, err)
+//	    }),
+//	)
+//
+// It follows retry-go's semantics, including zero-based try numbers for
+// [OnRetry] and [DelayTypeFunc], with these differences:
+//
+//   - Unless [DelayType] is set, delays follow redo's decorrelated backoff,
+//     starting from [Delay] and capped by [MaxDelay], rather than retry-go's
+//     default combination of exponential and random delays. A [Delay] of 0
+//     retries at once, as with [redo.NoDelay].
+//   - The wait before each retry chosen by a [DelayType] is made at the start
+//     of the retry itself, so it counts toward the try's duration, as seen in
+//     [redo.Status.LastDuration] and by [redo.SlowAttemptThreshold].
+//   - The error returned on exhaustion is redo's, wrapping only the error from
+//     the last try, rather than a list of every try's error, as with
+//     retry-go's LastErrorOnly(true). [errors.Is] and [errors.As] work with it
+//     as usual, and [redo.Cause] returns the last error unwrapped.
+//   - Options not listed here, such as MaxJitter or WrapContextErrorWithLastError,
+//     are not provided.
+//
+// New code should use redo directly.
+package retrygo
+
+import (
+	"context"
+	"math/bits"
+	"time"
+
+	"andy.dev/redo"
+)
+
+// RetryableFunc is the signature of the functions retried by [Do].
+type RetryableFunc func() error
+
+// RetryIfFunc reports whether a failed try should be retried.
+type RetryIfFunc func(error) bool
+
+// OnRetryFunc is called with the zero-based number of each failed try that is
+// retried, and its error.
+type OnRetryFunc func(n uint, err error)
+
+// DelayTypeFunc returns the delay after the failed try n, counting from zero.
+type DelayTypeFunc func(n uint, err error, config *Config) time.Duration
+
+// Config holds the settings made with the options passed to [Do].
+type Config struct {
+	attempts  uint
+	delay     time.Duration
+	maxDelay  time.Duration
+	delayType DelayTypeFunc
+	retryIf   RetryIfFunc
+	onRetry   OnRetryFunc
+	ctx       context.Context
+}
+
+// Option sets one of the settings of [Do].
+type Option func(*Config)
+
+// Attempts sets the number of tries to make. Setting it to 0 retries until the
+// function succeeds or the context is done. Default is 10.
+func Attempts(attempts uint) Option {
+	return func(c *Config) {
+		c.attempts = attempts
+	}
+}
+
+// Delay sets the delay used to start the backoff. Default is 100ms.
+func Delay(delay time.Duration) Option {
+	return func(c *Config) {
+		c.delay = delay
+	}
+}
+
+// MaxDelay sets the maximum delay between tries. Default is no maximum for a
+// [DelayType], and redo's [redo.DefaultMaxDelay] otherwise.
+func MaxDelay(maxDelay time.Duration) Option {
+	return func(c *Config) {
+		c.maxDelay = maxDelay
+	}
+}
+
+// DelayType sets the function computing each delay, such as [BackOffDelay] or
+// [FixedDelay]. Default is nil, which uses redo's backoff.
+func DelayType(delayType DelayTypeFunc) Option {
+	return func(c *Config) {
+		c.delayType = delayType
+	}
+}
+
+// RetryIf sets the function deciding whether a failed try is retried. If it
+// returns false, Do returns the error at once. Default retries every error
+// except those wrapped with [Unrecoverable].
+func RetryIf(retryIf RetryIfFunc) Option {
+	return func(c *Config) {
+		c.retryIf = retryIf
+	}
+}
+
+// OnRetry sets a function to call after each failed try for which the
+// [RetryIf] function returned true, including the last.
+func OnRetry(onRetry OnRetryFunc) Option {
+	return func(c *Config) {
+		c.onRetry = onRetry
+	}
+}
+
+// Context sets the context of the run, which ends it once done. Default is
+// [context.Background].
+func Context(ctx context.Context) Option {
+	return func(c *Config) {
+		c.ctx = ctx
+	}
+}
+
+// BackOffDelay is a [DelayTypeFunc] that doubles the delay after each try,
+// starting from [Delay].
+func BackOffDelay(n uint, _ error, config *Config) time.Duration {
+	d := max(config.delay, 1)
+	// stop doubling before the delay would overflow.
+	return d << min(n, uint(63-bits.Len64(uint64(d))))
+}
+
+// FixedDelay is a [DelayTypeFunc] that always returns [Delay].
+func FixedDelay(_ uint, _ error, config *Config) time.Duration {
+	return config.delay
+}
+
+// Unrecoverable wraps err so that it is never retried, whatever [RetryIf] is
+// set to. It is the same as [redo.Halt].
+func Unrecoverable(err error) error {
+	return redo.Halt(err)
+}
+
+// IsRecoverable reports whether err was not wrapped with [Unrecoverable].
+func IsRecoverable(err error) bool {
+	return !redo.Halted(err)
+}
+
+// Do retries fn using the given options.
+func Do(fn RetryableFunc, opts ...Option) error {
+	c := &Config{
+		attempts: 10,
+		delay:    100 * time.Millisecond,
+		retryIf:  IsRecoverable,
+		ctx:      context.Background(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	tries := int(min(c.attempts, uint(1<<31-1)))
+	if tries == 0 {
+		tries = -1
+	}
+	options := []redo.Option{redo.MaxTries(tries)}
+	if c.delayType != nil {
+		// the delays are made by the wrapper below, before each retry.
+		options = append(options, redo.NoDelay())
+	} else if c.delay <= 0 {
+		options = append(options, redo.NoDelay())
+	} else {
+		options = append(options, redo.InitialDelay(c.delay), redo.MaxDelay(c.maxDelay))
+	}
+	var lastErr error
+	return redo.FnCtx(c.ctx, func(ctx context.Context) error {
+		n := uint(redo.GetStatus(ctx).TryNumber - 1)
+		if c.delayType != nil && n > 0 {
+			d := c.delayType(n-1, lastErr, c)
+			if c.maxDelay > 0 {
+				d = min(d, c.maxDelay)
+			}
+			t := time.NewTimer(d)
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		err := fn()
+		if err == nil || redo.Halted(err) {
+			return err
+		}
+		lastErr = err
+		if !c.retryIf(err) {
+			return redo.Halt(err)
+		}
+		if c.onRetry != nil {
+			c.onRetry(n, err)
+		}
+		return err
+	}, options...)
+}
@@ -0,0 +1,134 @@
+package retrygo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"andy.dev/redo"
+)
+
+func TestDo(t *testing.T) {
+	errFail := errors.New("fail")
+	var (
+		tries   int
+		retries []uint
+	)
+	err := Do(
+		func() error {
+			tries++
+			if tries < 3 {
+				return errFail
+			}
+			return nil
+		},
+		Attempts(5),
+		Delay(time.Millisecond),
+		OnRetry(func(n uint, err error) {
+			retries = append(retries, n)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(retries) != "[0 1]" {
+		t.Fatalf("got OnRetry calls %v, want [0 1]", retries)
+	}
+
+	tries = 0
+	err = Do(func() error {
+		tries++
+		return errFail
+	}, Attempts(3), Delay(time.Millisecond))
+	if !errors.Is(err, errFail) || !redo.Exhausted(err) || tries != 3 {
+		t.Fatalf("got %v after %d tries, want exhausted after 3", err, tries)
+	}
+}
+
+func TestDoRetryIf(t *testing.T) {
+	errSpecial := errors.New("special")
+	tries := 0
+	var retries []uint
+	err := Do(
+		func() error {
+			tries++
+			if tries == 1 {
+				return errSpecial
+			}
+			return errors.New("other")
+		},
+		Delay(time.Millisecond),
+		RetryIf(func(err error) bool {
+			return errors.Is(err, errSpecial)
+		}),
+		OnRetry(func(n uint, err error) {
+			retries = append(retries, n)
+		}),
+	)
+	if err == nil || err.Error() != "other" || tries != 2 || len(retries) != 1 {
+		t.Fatalf("got %v after %d tries and %d retries, want other after 2 and 1", err, tries, len(retries))
+	}
+
+	tries = 0
+	err = Do(func() error {
+		tries++
+		return Unrecoverable(errSpecial)
+	})
+	if !errors.Is(err, errSpecial) || IsRecoverable(err) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want unrecoverable after 1", err, tries)
+	}
+}
+
+func TestDoDelayType(t *testing.T) {
+	var delays []string
+	_ = Do(
+		func() error { return errors.New("fail") },
+		Attempts(4),
+		Delay(time.Millisecond),
+		DelayType(func(n uint, err error, config *Config) time.Duration {
+			d := BackOffDelay(n, err, config)
+			delays = append(delays, fmt.Sprintf("%d:%v", n, d))
+			return d
+		}),
+	)
+	if want := "[0:1ms 1:2ms 2:4ms]"; fmt.Sprint(delays) != want {
+		t.Fatalf("got delays %v, want %v", delays, want)
+	}
+	if d := BackOffDelay(100, nil, &Config{delay: time.Second}); d < time.Second<<32 {
+		t.Fatalf("got overflowed delay %v", d)
+	}
+	if d := FixedDelay(5, nil, &Config{delay: time.Second}); d != time.Second {
+		t.Fatalf("got fixed delay %v, want 1s", d)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tries := 0
+	err := Do(func() error {
+		tries++
+		cancel()
+		return errors.New("fail")
+	}, Context(ctx), Attempts(0), Delay(time.Millisecond), DelayType(FixedDelay))
+	if !errors.Is(err, context.Canceled) || tries != 1 {
+		t.Fatalf("got %v after %d tries, want cancellation after 1", err, tries)
+	}
+}
+
+func TestDoNoDelay(t *testing.T) {
+	tries := 0
+	start := time.Now()
+	err := Do(func() error {
+		tries++
+		return errors.New("fail")
+	}, Attempts(5), Delay(0))
+	if !redo.Exhausted(err) || tries != 5 {
+		t.Fatalf("got %v after %d tries, want exhausted after 5", err, tries)
+	}
+	// redo's default initial delay would take far longer than this.
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("5 tries with no delay took %v", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package redo
+
+import (
+	"sync"
+	"time"
+
+	"andy.dev/redo/backoff"
+)
+
+// SharedIterator is a backoff shared by a group of runs, such as operations
+// that all depend on the same overloaded service, so that they back off
+// together rather than each at its own pace. See [SharedBackoff].
+//
+// Every failure in any run using it advances it one step, so the more runs
+// fail, the longer all of them wait. Any successful run resets it, on the basis
+// that the dependency has recovered. It is safe for concurrent use, and is
+// guarded by a single mutex that is held only to take the next delay, so
+// contention is low unless a very large number of runs fail at once.
+type SharedIterator struct {
+	mu     sync.Mutex
+	newFn  func() backoff.Iterator
+	delays backoff.Iterator
+	last   time.Duration
+}
+
+// NewSharedIterator returns a [*SharedIterator] following the same curve as
+// [backoff.New], with the given initial median and maximum delays and options.
+// firstFast is not supported, since there is no one first retry.
+func NewSharedIterator(initialMedian, maxDelay time.Duration, options ...backoff.Option) *SharedIterator {
+	newFn := func() backoff.Iterator {
+		return backoff.New(initialMedian, maxDelay, false, options...)
+	}
+	return &SharedIterator{newFn: newFn, delays: newFn()}
+}
+
+// Next advances the backoff, and returns the delay for the failure that
+// advanced it.
+func (s *SharedIterator) Next() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = s.delays()
+	return s.last
+}
+
+// Last returns the delay most recently returned by [SharedIterator.Next], or 0
+// if it has not been called since the iterator was created or reset.
+func (s *SharedIterator) Last() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Reset starts the backoff over from the beginning of its curve.
+func (s *SharedIterator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays = s.newFn()
+	s.last = 0
+}
+
+// SharedBackoff makes the run take its delays from it, which is shared with
+// other runs, instead of from its own backoff. This is an advanced feature for
+// pacing a group of operations against one resource; see [SharedIterator].
+// The delay is only taken once a try has failed, so within a try,
+// [Status].NextDelay is the delay most recently taken by any run, and it is
+// only the delay this run will wait once the try has failed, as seen by
+// [Each]. [InitialDelay], [MaxDelay] and the other options shaping the curve
+// are ignored, while those that adjust each delay, such as [QuantizeDelay],
+// still apply. Defaults to nil, which gives each run its own backoff.
+func SharedBackoff(it *SharedIterator) Option {
+	return func(o *opts) {
+		o.shared = it
+	}
+}
@@ -0,0 +1,67 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"andy.dev/redo/backoff"
+)
+
+func TestSharedBackoff(t *testing.T) {
+	const (
+		workers  = 4
+		failures = 3
+	)
+	shared := NewSharedIterator(10*time.Microsecond, 0, backoff.Median())
+	var (
+		mu     sync.Mutex
+		delays []time.Duration
+		wg     sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = FnCtx(context.Background(), func(context.Context) error {
+				return errors.New("overloaded")
+			}, SharedBackoff(shared), MaxTries(failures), AllowSubMillisecondDelays(true), Each(func(s Status) {
+				mu.Lock()
+				defer mu.Unlock()
+				delays = append(delays, s.NextDelay)
+			}))
+		}()
+	}
+	wg.Wait()
+
+	// every failure across the runs took the next step of one curve, rather
+	// than each run repeating the first few steps.
+	want := make([]time.Duration, workers*failures)
+	median := backoff.New(10*time.Microsecond, 0, false, backoff.Median())
+	for i := range want {
+		want[i] = median()
+	}
+	slices.Sort(delays)
+	if !slices.Equal(delays, want) {
+		t.Fatalf("got delays %v, want %v", delays, want)
+	}
+	if d := shared.Last(); d != want[len(want)-1] {
+		t.Fatalf("got last delay %v, want %v", d, want[len(want)-1])
+	}
+
+	// any successful run resets it.
+	if err := FnCtx(context.Background(), func(context.Context) error {
+		return nil
+	}, SharedBackoff(shared)); err != nil {
+		t.Fatal(err)
+	}
+	if d := shared.Last(); d != 0 {
+		t.Fatalf("got %v after success, want the backoff to be reset", d)
+	}
+	if d := shared.Next(); d != want[0] {
+		t.Fatalf("got %v after reset, want %v", d, want[0])
+	}
+}
@@ -0,0 +1,76 @@
+package redo
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Singleflight coalesces concurrent calls that share a key into a single call,
+// whose result is shared by all of the callers. It is intended to prevent a
+// stampede of expensive refreshes, such as fetching a new token, when many
+// retriers using the same refresh function fail at once. See
+// [RefreshSingleflight].
+//
+// The zero value is ready to use. A Singleflight must not be copied after
+// first use.
+type Singleflight[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	wg   sync.WaitGroup
+	dups int
+	val  T
+	err  error
+}
+
+// Do calls fn and returns its results, unless a call for the same key is
+// already in progress, in which case it waits for that call to complete and
+// returns its results instead. If fn panics, the panic is passed on to the
+// caller that made the call, while those waiting for it get an error.
+func (g *Singleflight[T]) Do(key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[T])
+	}
+	if f, ok := g.calls[key]; ok {
+		f.dups++
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.val, f.err
+	}
+	f := &flight[T]{}
+	f.wg.Add(1)
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			// give the waiters an error rather than a zero value and nil.
+			f.err = fmt.Errorf("redo: singleflight call panicked: %v", r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		f.wg.Done()
+		if r != nil {
+			panic(r)
+		}
+	}()
+	f.val, f.err = fn()
+	return f.val, f.err
+}
+
+// RefreshSingleflight wraps refreshFn so that concurrent refreshes sharing the
+// same key and [Singleflight] are coalesced into a single call to refreshFn,
+// with every caller receiving the same refreshed value or error. Since the
+// value is shared, IN should be a value that is safe for concurrent use by
+// every function being retried, such as an immutable token or a pointer to a
+// type that is safe for concurrent use.
+func RefreshSingleflight[IN any](key string, g *Singleflight[IN], refreshFn RefreshFn[IN]) RefreshFn[IN] {
+	return func() (IN, error) {
+		return g.Do(key, refreshFn)
+	}
+}
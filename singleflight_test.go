@@ -0,0 +1,104 @@
+package redo
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshSingleflight(t *testing.T) {
+	const callers = 10
+	var (
+		g       Singleflight[string]
+		calls   atomic.Int32
+		release = make(chan struct{})
+	)
+	refresh := RefreshSingleflight("token", &g, func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "fresh", nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = refresh()
+		}()
+	}
+	// wait for every caller to join the in-flight refresh
+	for {
+		g.mu.Lock()
+		f := g.calls["token"]
+		joined := f != nil && f.dups == callers-1
+		g.mu.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("refresh called %d times, want 1", n)
+	}
+	for i, r := range results {
+		if r != "fresh" {
+			t.Errorf("caller %d got %q, want %q", i, r, "fresh")
+		}
+	}
+
+	// once the flight has landed, the next refresh calls through again.
+	release = make(chan struct{})
+	close(release)
+	if _, err := refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("refresh called %d times, want 2", n)
+	}
+}
+
+func TestSingleflightPanic(t *testing.T) {
+	var g Singleflight[string]
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		_, _ = g.Do("key", func() (string, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+	waited := make(chan error, 1)
+	go func() {
+		_, err := g.Do("key", func() (string, error) {
+			t.Error("a second call was made while the first was in progress")
+			return "", nil
+		})
+		waited <- err
+	}()
+	// wait until the second caller is waiting on the first.
+	for {
+		g.mu.Lock()
+		dups := g.calls["key"].dups
+		g.mu.Unlock()
+		if dups == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if r := <-panicked; r != "boom" {
+		t.Fatalf("got panic %v in the caller making the call, want boom", r)
+	}
+	if err := <-waited; err == nil {
+		t.Fatal("got a nil error for the caller waiting on a call that panicked")
+	}
+}
@@ -0,0 +1,88 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// State is a snapshot of a run, taken with [StateSnapshot], holding enough to
+// carry the run on with [ResumeFrom] after a crash or restart. It is meant to
+// be persisted, such as by encoding it as JSON.
+type State struct {
+	// TryNumber is the number of the try the snapshot was taken in.
+	TryNumber int `json:"try"`
+	// Elapsed is the time since the start of the run, including any time
+	// carried over from an earlier run it was resumed from.
+	Elapsed time.Duration `json:"elapsed"`
+	// LastError is the message of the error from the previous try, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// StateSnapshot returns the [State] of the run ctx was passed to a function by,
+// for use with [ResumeFrom]. It returns false if ctx was not passed to a
+// function by one of the retriers, or was made with [ContextWithStatus] or
+// [DisableStatusContext].
+func StateSnapshot(ctx context.Context) (State, bool) {
+	s, ok := ctx.Value(retryCtxKey{}).(Status)
+	if !ok || s.run == nil {
+		return State{}, false
+	}
+	st := State{
+		TryNumber: s.TryNumber,
+		Elapsed:   s.run.elapsed(),
+	}
+	if s.Err != nil {
+		st.LastError = s.Err.Error()
+	}
+	return st, true
+}
+
+// ResumeFrom carries on a run from a [State] taken with [StateSnapshot], so that
+// a durable workflow can survive a crash or restart. The first try of the run
+// is numbered s.TryNumber, repeating the try the snapshot was taken in, as with
+// [StartAttempt]. The time already elapsed counts towards [MaxElapsed], and
+// the first try's [Status].Err is an error with the message of s.LastError,
+// if set. Since delays are randomized, the backoff will only approximately
+// match where the earlier run left off.
+func ResumeFrom(s State) Option {
+	return func(o *opts) {
+		o.startAttempt = s.TryNumber
+		o.resumeElapsed = s.Elapsed
+		o.resumeErr = s.LastError
+	}
+}
+
+// RemainingBudget returns how much of the [MaxElapsed] budget of the run ctx was
+// passed to a function by is left, measured from the start of the run by its
+// clock, so that the function can pass a proportionate timeout to a
+// dependency that takes one explicitly:
+//
+//	if left, ok := redo.RemainingBudget(ctx); ok {
+//	    req.Timeout = left / 2
+//	}
+//
+// It is never negative. It returns false if ctx was not passed to a function by
+// one of the retriers, the run has no MaxElapsed, or its status is not in the
+// context, as with [DisableStatusContext]. Any deadline of ctx itself is not
+// taken into account, since it is available from ctx.Deadline.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	s, ok := ctx.Value(retryCtxKey{}).(Status)
+	if !ok || s.run == nil || s.run.maxElapsed <= 0 {
+		return 0, false
+	}
+	return max(s.run.maxElapsed-s.run.elapsed(), 0), true
+}
+
+// elapsed returns the time since the start of the run.
+func (r *runState) elapsed() time.Duration {
+	return r.now().Sub(r.start)
+}
+
+// resumedErr returns the error to restore as the last error of a resumed run.
+func (o *opts) resumedErr() error {
+	if o.resumeErr == "" {
+		return nil
+	}
+	return errors.New(o.resumeErr)
+}
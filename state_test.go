@@ -0,0 +1,99 @@
+package redo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	if _, ok := StateSnapshot(context.Background()); ok {
+		t.Fatal("got a snapshot outside of a run")
+	}
+
+	clk := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var saved []byte
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		s, ok := StateSnapshot(ctx)
+		if !ok {
+			t.Fatal("no snapshot inside a run")
+		}
+		saved, _ = json.Marshal(s)
+		return errors.New("crash")
+	}, NoDelay(), MaxTries(3), withClock(clk))
+
+	var s State
+	if err := json.Unmarshal(saved, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.TryNumber != 3 || s.LastError != "crash" {
+		t.Fatalf("got snapshot %+v, want try 3 after crash", s)
+	}
+}
+
+func TestResumeFrom(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var (
+		tries []int
+		first error
+	)
+	err := FnCtx(context.Background(), func(ctx context.Context) error {
+		s := GetStatus(ctx)
+		if len(tries) == 0 {
+			first = s.Err
+		}
+		tries = append(tries, s.TryNumber)
+		return errors.New("fail")
+	},
+		InitialDelay(time.Second),
+		MaxDelay(time.Second),
+		MaxTries(-1),
+		MaxElapsed(10*time.Second),
+		ResumeFrom(State{TryNumber: 4, Elapsed: 8 * time.Second, LastError: "crash"}),
+		withClock(clk),
+	)
+	if !Exhausted(err) {
+		t.Fatalf("got %v, want exhausted", err)
+	}
+	if first == nil || first.Error() != "crash" {
+		t.Fatalf("got first status error %v, want crash", first)
+	}
+	// the 8s already used leaves room for only a couple more tries.
+	if tries[0] != 4 || len(tries) > 4 {
+		t.Fatalf("got tries %v, want a few starting from 4", tries)
+	}
+}
+
+func TestRemainingBudget(t *testing.T) {
+	if _, ok := RemainingBudget(context.Background()); ok {
+		t.Fatal("got a budget outside of a run")
+	}
+
+	clk := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var left []time.Duration
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		d, ok := RemainingBudget(ctx)
+		if !ok {
+			t.Fatal("no budget inside a run with MaxElapsed")
+		}
+		left = append(left, d)
+		return errors.New("fail")
+	}, InitialDelay(time.Second), MaxDelay(time.Second), MaxTries(-1), MaxElapsed(10*time.Second), withClock(clk))
+	if len(left) < 2 || left[0] != 10*time.Second {
+		t.Fatalf("got budgets %v, want several starting from 10s", left)
+	}
+	for i := 1; i < len(left); i++ {
+		if left[i] >= left[i-1] || left[i] < 0 {
+			t.Fatalf("budget did not decrease: %v", left)
+		}
+	}
+
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		if _, ok := RemainingBudget(ctx); ok {
+			t.Error("got a budget without MaxElapsed")
+		}
+		return nil
+	})
+}
@@ -5,14 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"strconv"
 	"time"
 )
 
-type retryCtxKeyT string
-
-const (
-	retryCtxKey retryCtxKeyT = "redo"
-)
+// retryCtxKey is the context key for the [Status] of the current try. Being an
+// unexported empty struct type, it cannot collide with any other package's keys.
+type retryCtxKey struct{}
 
 // GetStatus can be used to retrieve information about the current retry loop
 // from within the function being retried, as opposed to setting a callback with
@@ -20,11 +19,42 @@ const (
 // It will return Status{} if not called in a retry context, so make sure to use
 // [Retrying] if your function might be run outside of a retry loop.
 func GetStatus(ctx context.Context) Status {
-	stats := ctx.Value(retryCtxKey)
-	if stats == nil {
-		return Status{}
+	stats, _ := ctx.Value(retryCtxKey{}).(Status)
+	return stats
+}
+
+// ContextWithStatus returns a copy of ctx carrying s, as if it had been passed
+// to a function by one of the retriers, so that functions using [GetStatus]
+// can be tested in isolation, such as how they behave on the last try:
+//
+//	ctx := redo.ContextWithStatus(ctx, redo.Status{TryNumber: 3, MaxTries: 3})
+//
+// [Retrying] will return true for the returned context. [AttemptID] and
+// [ReportProgress] rely on state kept by the run, so the former will return an
+// ID without a run ID, and the latter does nothing.
+func ContextWithStatus(ctx context.Context, s Status) context.Context {
+	return context.WithValue(ctx, retryCtxKey{}, s)
+}
+
+// Retrying returns true if ctx was passed to a function by one of the
+// retriers, in which case [GetStatus] will return the status of the current
+// try.
+func Retrying(ctx context.Context) bool {
+	_, ok := ctx.Value(retryCtxKey{}).(Status)
+	return ok
+}
+
+// AttemptID returns an ID for the current try that can be used to correlate
+// logs and downstream requests across systems, of the form "<runID>-<try>". The
+// run ID is generated once at the start of each run, using the function set
+// with [RunIDFunc], so that every try in the run shares the same prefix. It
+// returns "" if ctx was not passed to a function by one of the retriers.
+func AttemptID(ctx context.Context) string {
+	s, ok := ctx.Value(retryCtxKey{}).(Status)
+	if !ok {
+		return ""
 	}
-	return stats.(Status)
+	return s.runID + "-" + strconv.Itoa(s.TryNumber)
 }
 
 // Status represents the state of the current retry loop.[GetStatus]
@@ -33,6 +63,23 @@ type Status struct {
 	MaxTries  int
 	Err       error
 	NextDelay time.Duration
+	// LastDuration is how long the most recent call to the function took. It is
+	// zero inside the first try, since there has been no call yet.
+	LastDuration time.Duration
+	// FastRetry is true if the try followed a delay of zero, such as with
+	// [FirstFast], [Burst] or [NoDelay], rather than a backed-off one.
+	FastRetry bool
+	// RepeatCount is the number of tries in a row, up to and including this
+	// one, that failed with the same error, if [CoalesceEach] is enabled. It
+	// is 0 otherwise, and inside each try.
+	RepeatCount int
+
+	// layout for the next_at attribute in LogValue, set by LogNextTime
+	nextLayout string
+	// ID of the run, for AttemptID
+	runID string
+	// state shared by the tries of the run, such as for RemainingBudget
+	run *runState
 }
 
 // String implements fmt.Stringer
@@ -67,19 +114,70 @@ func (s Status) Format(state fmt.State, verb rune) {
 }
 
 // LogValue implements [slog.LogValuer], allowing the retry status to be logged as a [slog.GroupValue]
+//
+// If [LogNextTime] is set, it will also include the approximate time of the
+// next try as "next_at".
 func (s Status) LogValue() slog.Value {
-	return slog.GroupValue(
+	attrs := []slog.Attr{
 		slog.Int("try", s.TryNumber),
 		slog.Int("max_tries", s.MaxTries),
 		slog.Duration("next", shortNext(s.NextDelay)),
-		slog.String("last_error", s.Err.Error()),
-	)
+		slog.Duration("last_duration", s.LastDuration),
+	}
+	if s.FastRetry {
+		attrs = append(attrs, slog.Bool("fast_retry", true))
+	}
+	if s.RepeatCount > 1 {
+		attrs = append(attrs, slog.Int("repeat_count", s.RepeatCount))
+	}
+	if s.nextLayout != "" {
+		attrs = append(attrs, slog.String("next_at", s.NextString(s.nextLayout)))
+	}
+	if s.Err != nil {
+		attrs = append(attrs, slog.String("last_error", s.Err.Error()))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 // Next returns a time.Time value representing the approximate time the next
-// iteration will occur, assuming it has just failed.
+// iteration will occur, assuming it has just failed. It is measured from the
+// current time, as given by the run's clock.
 func (s Status) Next() time.Time {
-	return time.Now().Add(s.NextDelay)
+	return s.NextFrom(s.now())
+}
+
+// NextFrom returns the approximate time the next iteration will occur, as with
+// [Status.Next], but measured from base instead of the current time, so that
+// it can be computed deterministically.
+func (s Status) NextFrom(base time.Time) time.Time {
+	return base.Add(s.NextDelay)
+}
+
+// now returns the current time from the clock of the run the status belongs
+// to, if any.
+func (s Status) now() time.Time {
+	if s.run != nil {
+		return s.run.now()
+	}
+	return time.Now()
+}
+
+// NextString returns the approximate time of the next try, as returned by
+// [Status.Next], formatted using layout, such as [time.RFC3339]. It returns ""
+// for a zero Status, which is not part of a run, and "never" if the delay is
+// so long that the next try will effectively never happen.
+func (s Status) NextString(layout string) string {
+	return s.nextString(s.now(), layout)
+}
+
+func (s Status) nextString(now time.Time, layout string) string {
+	switch {
+	case s.TryNumber == 0:
+		return ""
+	case s.NextDelay == math.MaxInt64:
+		return "never"
+	}
+	return s.NextFrom(now).Format(layout)
 }
 
 func shortNext(d time.Duration) time.Duration {
@@ -89,8 +187,8 @@ func shortNext(d time.Duration) time.Duration {
 	case d < time.Minute:
 		return d.Truncate(time.Second)
 	case d < time.Hour:
-		d.Truncate(time.Minute)
+		return d.Truncate(time.Minute)
 	}
-	// Otherwise truncate the number of hours to two decimal places.
-	return time.Duration(math.Round(d.Hours()*100) / 100)
+	// Otherwise round the number of hours to two decimal places.
+	return d.Round(time.Hour / 100)
 }
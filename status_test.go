@@ -0,0 +1,239 @@
+package redo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusContextKey(t *testing.T) {
+	type foreignKey string
+	ctx := context.WithValue(context.Background(), foreignKey("redo"), "not a status")
+	ctx = context.WithValue(ctx, "redo", "not a status either")
+	if Retrying(ctx) {
+		t.Fatal("Retrying returned true outside of a retry loop")
+	}
+	if s := GetStatus(ctx); s != (Status{}) {
+		t.Fatalf("GetStatus returned %v outside of a retry loop", s)
+	}
+
+	err := FnCtx(ctx, func(ctx context.Context) error {
+		if !Retrying(ctx) {
+			return Halt(errors.New("Retrying returned false inside retry loop"))
+		}
+		if s := GetStatus(ctx); s.TryNumber != 1 {
+			return Halt(errors.New("unexpected status"))
+		}
+		if ctx.Value(foreignKey("redo")) != "not a status" {
+			return Halt(errors.New("foreign context value was clobbered"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNextString(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{Status{TryNumber: 1, NextDelay: 90 * time.Second}, "2024-03-01T12:01:30Z"},
+		{Status{TryNumber: 1}, "2024-03-01T12:00:00Z"},
+		{Status{TryNumber: 1, NextDelay: math.MaxInt64}, "never"},
+		{Status{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.status.nextString(now, time.RFC3339); got != tt.want {
+			t.Errorf("%+s: got %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestNextFrom(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := Status{TryNumber: 2, NextDelay: 3 * time.Second}
+	if got, want := s.NextFrom(base), base.Add(3*time.Second); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// within a run, Next uses the run's clock.
+	clk := newFakeClock(base)
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		return Halt(errors.New("fail"))
+	}, InitialDelay(time.Minute), withClock(clk), Each(func(s Status) {
+		if got, want := s.Next(), base.Add(s.NextDelay); !got.Equal(want) {
+			t.Errorf("got next %v, want %v", got, want)
+		}
+	}))
+}
+
+func TestLogNextTime(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		logger.Info("before", "status", GetStatus(ctx))
+		return Halt(errors.New("fail"))
+	}, LogNextTime(time.RFC3339), Each(func(s Status) {
+		logger.Info("after", "status", s)
+	}))
+	out := buf.String()
+	if n := strings.Count(out, "status.next_at="); n != 2 {
+		t.Fatalf("got %d next_at attributes, want 2:\n%s", n, out)
+	}
+	if n := strings.Count(out, "status.last_error="); n != 1 {
+		t.Fatalf("got %d last_error attributes, want 1:\n%s", n, out)
+	}
+}
+
+func TestAttemptID(t *testing.T) {
+	if id := AttemptID(context.Background()); id != "" {
+		t.Fatalf("got %q outside of a run, want empty", id)
+	}
+	run := func(opts ...Option) []string {
+		var ids []string
+		_ = FnCtx(context.Background(), func(ctx context.Context) error {
+			ids = append(ids, AttemptID(ctx))
+			return errors.New("fail")
+		}, append([]Option{MaxTries(3), NoDelay()}, opts...)...)
+		return ids
+	}
+
+	ids := run()
+	if len(ids) != 3 {
+		t.Fatalf("got %d IDs, want 3", len(ids))
+	}
+	prefix, _, _ := strings.Cut(ids[0], "-")
+	seen := map[string]bool{}
+	for i, id := range ids {
+		if seen[id] {
+			t.Errorf("duplicate ID %q", id)
+		}
+		seen[id] = true
+		if want := prefix + "-" + string(rune('1'+i)); id != want {
+			t.Errorf("try %d: got %q, want %q", i+1, id, want)
+		}
+	}
+	if other := run(); strings.HasPrefix(other[0], prefix+"-") {
+		t.Errorf("expected a new run ID, got %q and %q", ids[0], other[0])
+	}
+
+	ids = run(RunIDFunc(func() string { return "trace" }))
+	if ids[0] != "trace-1" || ids[2] != "trace-3" {
+		t.Errorf("got %v, want IDs from RunIDFunc", ids)
+	}
+}
+
+func TestDisableStatusContext(t *testing.T) {
+	ctx := context.Background()
+	tries := 0
+	err := FnCtx(ctx, func(fctx context.Context) error {
+		tries++
+		if fctx != ctx || Retrying(fctx) || GetStatus(fctx) != (Status{}) {
+			t.Errorf("got a derived context on try %d, want the original", tries)
+		}
+		return errors.New("fail")
+	}, DisableStatusContext(), NoDelay(), MaxTries(3), Each(func(s Status) {
+		if s.TryNumber != tries {
+			t.Errorf("got status for try %d, want %d", s.TryNumber, tries)
+		}
+	}))
+	if !Exhausted(err) || tries != 3 {
+		t.Fatalf("got %v after %d tries, want exhausted after 3", err, tries)
+	}
+}
+
+func BenchmarkStatusContext(b *testing.B) {
+	fail := func(context.Context) error { return errors.New("fail") }
+	for _, disabled := range []bool{false, true} {
+		options := []Option{NoDelay(), MaxTries(10)}
+		if disabled {
+			options = append(options, DisableStatusContext())
+		}
+		b.Run(fmt.Sprintf("DisableStatusContext=%v", disabled), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				_ = FnCtx(context.Background(), fail, options...)
+			}
+		})
+	}
+}
+
+func TestWithContextLogger(t *testing.T) {
+	type loggerKey struct{}
+	extract := func(ctx context.Context) *slog.Logger {
+		logger, _ := ctx.Value(loggerKey{}).(*slog.Logger)
+		return logger
+	}
+	store := func(ctx context.Context, logger *slog.Logger) context.Context {
+		return context.WithValue(ctx, loggerKey{}, logger)
+	}
+
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), loggerKey{}, slog.New(slog.NewTextHandler(&buf, nil)))
+	_ = FnCtx(ctx, func(ctx context.Context) error {
+		extract(ctx).Info("calling")
+		return errors.New("fail")
+	}, NoDelay(), MaxTries(2), WithContextLogger(extract, store))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		// each try is tagged once, not once per try so far.
+		if n := strings.Count(line, "retry.try="); n != 1 || !strings.Contains(line, fmt.Sprintf("retry.try=%d", i+1)) {
+			t.Errorf("line %d missing its try attribute: %s", i+1, line)
+		}
+	}
+
+	// without a logger in the context, nothing is stored.
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		if extract(ctx) != nil {
+			t.Error("expected no logger")
+		}
+		return nil
+	}, WithContextLogger(extract, store))
+}
+
+func TestContextWithStatus(t *testing.T) {
+	want := Status{TryNumber: 3, MaxTries: 3, Err: errors.New("fail"), NextDelay: time.Second}
+	ctx := ContextWithStatus(context.Background(), want)
+	if !Retrying(ctx) || GetStatus(ctx) != want {
+		t.Fatalf("got %+v, want %+v", GetStatus(ctx), want)
+	}
+	lastTry := func(ctx context.Context) bool {
+		s := GetStatus(ctx)
+		return s.TryNumber == s.MaxTries
+	}
+	if !lastTry(ctx) {
+		t.Fatal("expected the injected status to be the last try")
+	}
+	SetProgress(ctx, 0.5) // must not panic without a run
+}
+
+func TestFastRetry(t *testing.T) {
+	var fast []bool
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	_ = FnCtx(context.Background(), func(ctx context.Context) error {
+		s := GetStatus(ctx)
+		fast = append(fast, s.FastRetry)
+		logger.Info("try", "status", s)
+		return errors.New("fail")
+	}, FirstFast(true), InitialDelay(time.Millisecond), MaxTries(4))
+	if want := []bool{false, true, false, false}; !slices.Equal(fast, want) {
+		t.Fatalf("got FastRetry %v, want %v", fast, want)
+	}
+	if n := strings.Count(buf.String(), "status.fast_retry=true"); n != 1 {
+		t.Fatalf("got %d fast_retry attributes, want 1:\n%s", n, buf.String())
+	}
+}